@@ -8,12 +8,19 @@ import (
 
 type Context interface {
 	Task() *Task
+	// Attempt is the number of the current launch of the task starting from 1, see Task.Attempt
+	Attempt() int
+	Headers() map[string]string
+	JobRun() *JobRun
 	Context() context.Context
 	CreateSubtask(sub CreateTask)
 	BindState(state any) error
 	SetState(state any) error
 	SetRetryAfter(timeout time.Duration)
 	SetContext(ctx context.Context)
+	Checkpoint(step string, fn func() error) error
+	Sleep(d time.Duration) error
+	WaitForSignal(name string, timeout time.Duration) ([]byte, error)
 }
 
 type taskContext struct {
@@ -21,6 +28,8 @@ type taskContext struct {
 	task       *Task
 	subtasks   []CreateTask
 	retryAfter time.Duration
+	sleeps     int
+	signals    map[string]int
 
 	taskEngine Engine
 }
@@ -29,6 +38,14 @@ func (c *taskContext) Task() *Task {
 	return c.task
 }
 
+func (c *taskContext) Attempt() int {
+	return c.task.Attempt
+}
+
+func (c *taskContext) Headers() map[string]string {
+	return c.task.Headers
+}
+
 func (c *taskContext) Context() context.Context {
 	return c.ctx
 }
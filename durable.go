@@ -0,0 +1,110 @@
+package stepper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/samber/lo"
+)
+
+var ErrTaskSuspended = errors.New("task is suspended")
+
+const durableStateKey = "__durable"
+
+type suspendError struct {
+	until time.Time
+	// signal is set when the task waits for the signal number count
+	signal string
+	count  int
+}
+
+func (e *suspendError) Error() string {
+	return fmt.Sprintf("%s until %s", ErrTaskSuspended, e.until.Format(time.RFC3339))
+}
+
+func (e *suspendError) Unwrap() error {
+	return ErrTaskSuspended
+}
+
+type durableState struct {
+	Checkpoints []string             `json:"checkpoints"`
+	Sleeps      int                  `json:"sleeps"`
+	WakeAt      time.Time            `json:"wakeAt"`
+	Signals     map[string]time.Time `json:"signals"`
+}
+
+func (c *taskContext) durableState() (durableState, error) {
+	var state durableState
+
+	if b := c.task.MiddlewaresState[durableStateKey]; len(b) > 0 {
+		if err := json.Unmarshal(b, &state); err != nil {
+			return state, fmt.Errorf("invalid durable state: %w", err)
+		}
+	}
+
+	return state, nil
+}
+
+func (c *taskContext) setDurableState(state durableState) {
+	b, _ := json.Marshal(state)
+
+	if c.task.MiddlewaresState == nil {
+		c.task.MiddlewaresState = map[string][]byte{}
+	}
+
+	c.task.MiddlewaresState[durableStateKey] = b
+}
+
+// Checkpoint runs fn only if the step has not been completed by a previous launch of the task.
+// The completed step is saved immediately, so it is not repeated after a crash of the node.
+func (c *taskContext) Checkpoint(step string, fn func() error) error {
+	state, err := c.durableState()
+	if err != nil {
+		return err
+	}
+
+	if lo.Contains(state.Checkpoints, step) {
+		return nil
+	}
+
+	if err := fn(); err != nil {
+		return err
+	}
+
+	state.Checkpoints = append(state.Checkpoints, step)
+	c.setDurableState(state)
+
+	if err := c.taskEngine.SetMiddlewaresState(c.ctx, c.task); err != nil {
+		return fmt.Errorf("cannot save checkpoint=%s: %w", step, err)
+	}
+
+	return nil
+}
+
+// Sleep suspends the task for the duration. The returned error must be returned from the handler,
+// the task will be launched again after the timeout and the same call of Sleep will return nil.
+func (c *taskContext) Sleep(d time.Duration) error {
+	c.sleeps++
+
+	state, err := c.durableState()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case c.sleeps < state.Sleeps:
+		return nil
+	case c.sleeps == state.Sleeps:
+		if !time.Now().Before(state.WakeAt) {
+			return nil
+		}
+	default:
+		state.Sleeps = c.sleeps
+		state.WakeAt = time.Now().Add(d)
+		c.setDurableState(state)
+	}
+
+	return &suspendError{until: state.WakeAt}
+}
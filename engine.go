@@ -8,25 +8,78 @@ import (
 type Engine interface {
 	TaskEngine
 	JobEngine
+	NodeEngine
 }
 
 type TaskEngine interface {
+	GetTask(ctx context.Context, id string) (*Task, error)
+	GetTaskChildren(ctx context.Context, parent string) ([]*Task, error)
+	// GetRelatedTask returns an unfinished task with the same name and custom id which was published before the task
 	GetRelatedTask(ctx context.Context, task *Task) (*Task, error)
-	FindNextTask(ctx context.Context, statuses []string) (*Task, error)
+	FindNextTask(ctx context.Context, statuses []string, filter ClaimFilter) (*Task, error)
 	ReleaseTask(ctx context.Context, task *Task) error
 	WaitTaskForSubtasks(ctx context.Context, task *Task) error
 	FailTask(ctx context.Context, task *Task, err error, timeout time.Duration) error
+	// SuspendTask postpones the task, the claim of the suspended launch is not counted in Task.Attempt
+	SuspendTask(ctx context.Context, task *Task, launchAt time.Time) error
+	DeadLetterTask(ctx context.Context, task *Task, err error) error
+	// CountDueTasks returns counts of tasks which are ready to be launched grouped by names, queues and tags
+	CountDueTasks(ctx context.Context) ([]DueTasks, error)
 	CreateTask(ctx context.Context, task *Task) error
+	// GetUnreleasedTaskChildren returns a subtask which is not over yet: created, in progress,
+	// waiting for its own subtasks or failed and going to be retried
 	GetUnreleasedTaskChildren(ctx context.Context, task *Task) (*Task, error)
 	SetState(ctx context.Context, task *Task, state []byte) error
-	CollectMetrics(ctx context.Context) error
+	// SetMiddlewaresState saves Task.MiddlewaresState of the claimed task
+	SetMiddlewaresState(ctx context.Context, task *Task) error
+	CreateSignal(ctx context.Context, signal *Signal) error
+	GetSignals(ctx context.Context, task *Task, name string) ([]*Signal, error)
+	// WakeTask launches the suspended task immediately
+	WakeTask(ctx context.Context, id string) error
+	// KeepTaskLease renews the claim of the task until the context is done, so a long handler is not claimed again
+	KeepTaskLease(ctx context.Context, task *Task) error
+	// GetTaskStats returns counts of tasks grouped by names and statuses
+	GetTaskStats(ctx context.Context) ([]TaskStats, error)
 }
 
 type JobEngine interface {
-	FindNextJob(ctx context.Context, statuses []string) (*Job, error)
-	GetUnreleasedJobChildren(ctx context.Context, name string) (*Task, error)
+	FindNextJob(ctx context.Context, statuses []string, filter ClaimFilter) (*Job, error)
+	GetUnreleasedJobChildren(ctx context.Context, job *Job) (*Task, error)
 	Release(ctx context.Context, job *Job, nextLaunchAt time.Time) error
+	RetireJob(ctx context.Context, job *Job) error
 	WaitForSubtasks(ctx context.Context, job *Job) error
 	RegisterJob(ctx context.Context, cfg *JobConfig) error
+	GetJob(ctx context.Context, name string) (*Job, error)
+	PauseJob(ctx context.Context, name string) error
+	ResumeJob(ctx context.Context, job *Job) error
+	TriggerJob(ctx context.Context, name string) error
+	DeleteJob(ctx context.Context, name string) error
+	UpdateJobPattern(ctx context.Context, name string, pattern string, nextLaunchAt time.Time) error
+	GetJobs(ctx context.Context) ([]*Job, error)
+	// MarkJobOrphaned marks the job as orphaned only if it is created or released
+	MarkJobOrphaned(ctx context.Context, name string) error
+	SaveJobRun(ctx context.Context, run *JobRun) error
+	GetJobRun(ctx context.Context, id string) (*JobRun, error)
+	GetJobRuns(ctx context.Context, name string, limit int) ([]*JobRun, error)
+	// DeleteJobRuns deletes runs of the job with numbers less than the number
+	DeleteJobRuns(ctx context.Context, name string, number int) error
 	Init(ctx context.Context) error
 }
+
+type NodeEngine interface {
+	SaveNode(ctx context.Context, node *Node) error
+	GetNodes(ctx context.Context, seenAfter time.Time) ([]*Node, error)
+	DeleteNodes(ctx context.Context, seenBefore time.Time) error
+}
+
+// ClaimFilter restricts tasks and jobs which can be claimed by a node.
+type ClaimFilter struct {
+	// Tags of the node, a task or a job is claimed only if all its tags are in the list, nil means any tags
+	Tags []string
+	// Names of tasks or jobs which the node can handle, nil means any name
+	Names []string
+	// Queues of tasks, nil means any queue
+	Queues []string
+	// ExactTags claims only tasks which have all Tags, so a task is claimed only if its tags are equal to Tags
+	ExactTags bool
+}
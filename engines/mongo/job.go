@@ -7,24 +7,57 @@ import (
 )
 
 type job struct {
-	Status       string    `bson:"status"`
-	Name         string    `bson:"name"`
-	Pattern      string    `bson:"pattern"`
-	NextLaunchAt time.Time `bson:"naxtLaunchAt"`
+	Status        string        `bson:"status"`
+	Name          string        `bson:"name"`
+	Tags          []string      `bson:"tags"`
+	Pattern       string        `bson:"pattern"`
+	Interval      time.Duration `bson:"interval"`
+	RunAt         time.Time     `bson:"runAt"`
+	Jitter        float64       `bson:"jitter"`
+	Timezone      string        `bson:"timezone"`
+	MisfirePolicy string        `bson:"misfirePolicy"`
+	Overlap       string        `bson:"overlap"`
+	NextLaunchAt  time.Time     `bson:"nextLaunchAt"`
+	LaunchDelay   time.Duration `bson:"launchDelay"`
+	ScheduledAt   time.Time     `bson:"scheduledAt"`
+	RunId         string        `bson:"runId"`
+	OrphanedAt    time.Time     `bson:"orphanedAt"`
 }
 
 func (j *job) FromModel(model *stepper.Job) {
 	j.Status = model.Status
 	j.Name = model.Name
+	j.Tags = model.Tags
 	j.Pattern = model.Pattern
+	j.Interval = model.Interval
+	j.RunAt = model.RunAt
+	j.Jitter = model.Jitter
+	j.Timezone = model.Timezone
+	j.MisfirePolicy = string(model.MisfirePolicy)
+	j.Overlap = string(model.Overlap)
 	j.NextLaunchAt = model.NextLaunchAt
+	j.LaunchDelay = model.LaunchDelay
+	j.ScheduledAt = model.ScheduledAt
+	j.RunId = model.RunId
+	j.OrphanedAt = model.OrphanedAt
 }
 
 func (j *job) ToModel() *stepper.Job {
 	return &stepper.Job{
-		Status:       j.Status,
-		Name:         j.Name,
-		Pattern:      j.Pattern,
-		NextLaunchAt: j.NextLaunchAt,
+		Status:        j.Status,
+		Name:          j.Name,
+		Tags:          j.Tags,
+		Pattern:       j.Pattern,
+		Interval:      j.Interval,
+		RunAt:         j.RunAt,
+		Jitter:        j.Jitter,
+		Timezone:      j.Timezone,
+		MisfirePolicy: stepper.MisfirePolicy(j.MisfirePolicy),
+		Overlap:       stepper.OverlapPolicy(j.Overlap),
+		NextLaunchAt:  j.NextLaunchAt,
+		LaunchDelay:   j.LaunchDelay,
+		ScheduledAt:   j.ScheduledAt,
+		RunId:         j.RunId,
+		OrphanedAt:    j.OrphanedAt,
 	}
 }
@@ -0,0 +1,45 @@
+package mongo
+
+import (
+	"time"
+
+	"github.com/matroskin13/stepper"
+)
+
+type jobRun struct {
+	ID             string    `bson:"id"`
+	Job            string    `bson:"job"`
+	TaskId         string    `bson:"taskId"`
+	Number         int       `bson:"number"`
+	Status         string    `bson:"status"`
+	PreviousStatus string    `bson:"previousStatus"`
+	ScheduledAt    time.Time `bson:"scheduledAt"`
+	StartedAt      time.Time `bson:"startedAt"`
+	FinishedAt     time.Time `bson:"finishedAt"`
+}
+
+func (r *jobRun) FromModel(model *stepper.JobRun) {
+	r.ID = model.ID
+	r.Job = model.Job
+	r.TaskId = model.TaskId
+	r.Number = model.Number
+	r.Status = model.Status
+	r.PreviousStatus = model.PreviousStatus
+	r.ScheduledAt = model.ScheduledAt
+	r.StartedAt = model.StartedAt
+	r.FinishedAt = model.FinishedAt
+}
+
+func (r *jobRun) ToModel() *stepper.JobRun {
+	return &stepper.JobRun{
+		ID:             r.ID,
+		Job:            r.Job,
+		TaskId:         r.TaskId,
+		Number:         r.Number,
+		Status:         r.Status,
+		PreviousStatus: r.PreviousStatus,
+		ScheduledAt:    r.ScheduledAt,
+		StartedAt:      r.StartedAt,
+		FinishedAt:     r.FinishedAt,
+	}
+}
@@ -0,0 +1,48 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/matroskin13/stepper"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ErrLeaseLost is returned when a claimed task is released or claimed again after its lease expired.
+var ErrLeaseLost = errors.New("lease is lost")
+
+// DefaultLeaseTimeout is the time after which a claimed task or job can be claimed again,
+// the lease of a task is renewed while its handler is running.
+const DefaultLeaseTimeout = 5 * time.Minute
+
+// leaseExpiredAt returns the time before which leases are expired
+func (m *Mongo) leaseExpiredAt() time.Time {
+	return time.Now().Add(-m.leaseTimeout)
+}
+
+// KeepTaskLease bumps lock_at of the claimed task every third of the lease timeout until the context is done.
+func (m *Mongo) KeepTaskLease(ctx context.Context, task *stepper.Task) error {
+	ticker := time.NewTicker(m.leaseTimeout / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			res, err := m.tasks.UpdateOne(
+				ctx,
+				bson.M{"id": task.ID, "lock_at": bson.M{"$ne": nil}},
+				bson.M{"$set": bson.M{"lock_at": time.Now()}},
+			)
+			if err != nil {
+				return err
+			}
+
+			if res.MatchedCount == 0 {
+				return ErrLeaseLost
+			}
+		}
+	}
+}
@@ -1,13 +1,44 @@
 package mongo
 
 import (
+	"context"
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.mongodb.org/mongo-driver/bson"
 )
 
 var (
+	// Deprecated: use stepper_tasks and stepper_queue_lag_seconds which are collected by the service.
 	overallUnreleasedMetric = promauto.NewGauge(prometheus.GaugeOpts{
 		Name: "stepper_mongo_count_all_unreleased",
-		Help: "Can be used to detect overall unreleased tasks",
+		Help: "Can be used to detect overall unreleased tasks, deprecated: use stepper_tasks",
 	})
 )
+
+// Deprecated: the service collects queue metrics of any engine, CollectMetrics only updates
+// the stepper_mongo_count_all_unreleased gauge and is called by the service as well.
+func (m *Mongo) CollectMetrics(ctx context.Context) error {
+	unreleasedCount, err := m.tasks.CountDocuments(ctx, bson.M{
+		"$or": bson.A{
+			bson.M{
+				"status":   "failed",
+				"launchAt": bson.M{"$ne": nil},
+			},
+			bson.M{
+				"status": bson.M{"$nin": []string{"failed", "released", "dead_letter"}},
+				"launchAt": bson.M{
+					"$lte": time.Now(),
+				},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	overallUnreleasedMetric.Set(float64(unreleasedCount))
+
+	return nil
+}
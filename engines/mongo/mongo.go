@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/matroskin13/stepper"
+	"github.com/samber/lo"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -12,47 +13,284 @@ import (
 )
 
 type Mongo struct {
-	jobs  *mongo.Collection
-	tasks *mongo.Collection
+	jobs    *mongo.Collection
+	jobRuns *mongo.Collection
+	tasks   *mongo.Collection
+	signals *mongo.Collection
+	nodes   *mongo.Collection
+
+	leaseTimeout time.Duration
 }
 
-func NewMongoWithDb(db *mongo.Database) *Mongo {
+func NewMongoWithDb(db *mongo.Database, opts ...Option) *Mongo {
+	c := config{}
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	names := c.collections.withDefaults(c.prefix)
+
 	return &Mongo{
-		jobs:  db.Collection("jobs"),
-		tasks: db.Collection("tasks"),
+		jobs:    db.Collection(names.Jobs),
+		jobRuns: db.Collection(names.JobRuns),
+		tasks:   db.Collection(names.Tasks),
+		signals: db.Collection(names.Signals),
+		nodes:   db.Collection(names.Nodes),
+
+		leaseTimeout: lo.Ternary(c.leaseTimeout == 0, DefaultLeaseTimeout, c.leaseTimeout),
 	}
 }
 
-func NewMongo(host string, database string) (*Mongo, error) {
+func NewMongo(host string, database string, opts ...Option) (*Mongo, error) {
 	db, err := createMongoDatabase(host, database)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Mongo{
-		jobs:  db.Collection("jobs"),
-		tasks: db.Collection("tasks"),
-	}, nil
+	return NewMongoWithDb(db, opts...), nil
 }
 
 func (m *Mongo) RegisterJob(ctx context.Context, cfg *stepper.JobConfig) error {
-	nextLaunchAt, err := cfg.NextLaunch()
+	nextLaunchAt, launchDelay, err := cfg.FirstLaunch()
 	if err != nil {
 		return err
 	}
 
+	var existing job
+
 	query := bson.M{"name": cfg.Name}
-	update := bson.M{
-		"nextLaunchAt": nextLaunchAt,
-		"name":         cfg.Name,
-		"tags":         cfg.Tags,
-		"pattern":      cfg.Pattern,
-		"status":       "created",
+
+	if err := m.jobs.FindOne(ctx, query).Decode(&existing); err != nil && err != mongo.ErrNoDocuments {
+		return err
+	}
+
+	set := bson.M{
+		"name":          cfg.Name,
+		"tags":          cfg.Tags,
+		"pattern":       cfg.Pattern,
+		"interval":      cfg.Interval,
+		"runAt":         cfg.RunAt,
+		"jitter":        cfg.Jitter,
+		"timezone":      cfg.Timezone,
+		"misfirePolicy": cfg.MisfirePolicy,
+		"overlap":       cfg.Overlap,
+	}
+
+	scheduleChanged := existing.Pattern != cfg.Pattern ||
+		existing.Timezone != cfg.Timezone ||
+		existing.Interval != cfg.Interval ||
+		!existing.RunAt.Equal(cfg.RunAt.Truncate(time.Millisecond))
+
+	// keep the schedule of the existing job, otherwise launches missed during a downtime will be lost
+	if existing.Name == "" || scheduleChanged {
+		set["nextLaunchAt"] = nextLaunchAt
+		set["launchDelay"] = launchDelay
+	}
+
+	update := bson.M{"$set": set}
+
+	switch {
+	case existing.Name == "":
+		update["$setOnInsert"] = bson.M{"status": "created"}
+	case existing.Status == "orphaned":
+		set["status"] = "released"
+		set["orphanedAt"] = nil
+	case existing.Status == "retired" && scheduleChanged:
+		set["status"] = "released"
+	}
+
+	_, err = m.jobs.UpdateOne(ctx, query, update, options.Update().SetUpsert(true))
+
+	return err
+}
+
+func (m *Mongo) GetJob(ctx context.Context, name string) (*stepper.Job, error) {
+	var _job job
+
+	if err := m.jobs.FindOne(ctx, bson.M{"name": name}).Decode(&_job); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return _job.ToModel(), nil
+}
+
+func (m *Mongo) PauseJob(ctx context.Context, name string) error {
+	_, err := m.jobs.UpdateOne(ctx, bson.M{"name": name}, bson.M{"$set": bson.M{"status": "paused"}})
+
+	return err
+}
+
+func (m *Mongo) ResumeJob(ctx context.Context, job *stepper.Job) error {
+	_, err := m.jobs.UpdateOne(
+		ctx,
+		bson.M{"name": job.Name, "status": "paused"},
+		bson.M{"$set": bson.M{
+			"lock_at":      nil,
+			"status":       job.Status,
+			"nextLaunchAt": job.NextLaunchAt,
+			"launchDelay":  job.LaunchDelay,
+		}},
+	)
+
+	return err
+}
+
+func (m *Mongo) TriggerJob(ctx context.Context, name string) error {
+	_, err := m.jobs.UpdateOne(
+		ctx,
+		bson.M{"name": name, "status": bson.M{"$in": []string{"created", "released"}}},
+		bson.M{"$set": bson.M{"nextLaunchAt": time.Now(), "launchDelay": 0}},
+	)
+
+	return err
+}
+
+func (m *Mongo) DeleteJob(ctx context.Context, name string) error {
+	_, err := m.jobs.DeleteOne(ctx, bson.M{"name": name})
+
+	return err
+}
+
+func (m *Mongo) UpdateJobPattern(ctx context.Context, name string, pattern string, nextLaunchAt time.Time) error {
+	if _, err := m.jobs.UpdateOne(ctx, bson.M{"name": name}, bson.M{"$set": bson.M{
+		"pattern":  pattern,
+		"interval": 0,
+		"runAt":    time.Time{},
+	}}); err != nil {
+		return err
 	}
 
-	opts := options.FindOneAndReplace().SetUpsert(true).SetReturnDocument(options.After)
+	// a running job uses nextLaunchAt to check its subtasks, the launch will be calculated after the release
+	_, err := m.jobs.UpdateOne(
+		ctx,
+		bson.M{"name": name, "status": bson.M{"$nin": []string{"waiting", "in_progress"}}},
+		bson.M{"$set": bson.M{"nextLaunchAt": nextLaunchAt, "launchDelay": 0}},
+	)
 
-	return m.jobs.FindOneAndReplace(ctx, query, update, opts).Err()
+	return err
+}
+
+func (m *Mongo) GetJobs(ctx context.Context) ([]*stepper.Job, error) {
+	cursor, err := m.jobs.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+
+	var jobs []job
+
+	if err := cursor.All(ctx, &jobs); err != nil {
+		return nil, err
+	}
+
+	result := make([]*stepper.Job, 0, len(jobs))
+	for i := range jobs {
+		result = append(result, jobs[i].ToModel())
+	}
+
+	return result, nil
+}
+
+func (m *Mongo) MarkJobOrphaned(ctx context.Context, name string) error {
+	_, err := m.jobs.UpdateOne(
+		ctx,
+		bson.M{"name": name, "status": bson.M{"$in": []string{"created", "released"}}},
+		bson.M{"$set": bson.M{
+			"status":     "orphaned",
+			"orphanedAt": time.Now(),
+		}},
+	)
+
+	return err
+}
+
+func (m *Mongo) SaveNode(ctx context.Context, model *stepper.Node) error {
+	n := node{}
+	n.FromModel(model)
+
+	_, err := m.nodes.ReplaceOne(ctx, bson.M{"id": n.ID}, n, options.Replace().SetUpsert(true))
+
+	return err
+}
+
+func (m *Mongo) GetNodes(ctx context.Context, seenAfter time.Time) ([]*stepper.Node, error) {
+	cursor, err := m.nodes.Find(ctx, bson.M{"seenAt": bson.M{"$gte": seenAfter}})
+	if err != nil {
+		return nil, err
+	}
+
+	var nodes []node
+
+	if err := cursor.All(ctx, &nodes); err != nil {
+		return nil, err
+	}
+
+	result := make([]*stepper.Node, 0, len(nodes))
+	for i := range nodes {
+		result = append(result, nodes[i].ToModel())
+	}
+
+	return result, nil
+}
+
+func (m *Mongo) DeleteNodes(ctx context.Context, seenBefore time.Time) error {
+	_, err := m.nodes.DeleteMany(ctx, bson.M{"seenAt": bson.M{"$lt": seenBefore}})
+
+	return err
+}
+
+func (m *Mongo) SaveJobRun(ctx context.Context, run *stepper.JobRun) error {
+	r := jobRun{}
+	r.FromModel(run)
+
+	_, err := m.jobRuns.ReplaceOne(ctx, bson.M{"id": run.ID}, r, options.Replace().SetUpsert(true))
+
+	return err
+}
+
+func (m *Mongo) DeleteJobRuns(ctx context.Context, name string, number int) error {
+	_, err := m.jobRuns.DeleteMany(ctx, bson.M{"job": name, "number": bson.M{"$lt": number}})
+
+	return err
+}
+
+func (m *Mongo) GetJobRun(ctx context.Context, id string) (*stepper.JobRun, error) {
+	var run jobRun
+
+	if err := m.jobRuns.FindOne(ctx, bson.M{"id": id}).Decode(&run); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return run.ToModel(), nil
+}
+
+func (m *Mongo) GetJobRuns(ctx context.Context, name string, limit int) ([]*stepper.JobRun, error) {
+	opts := options.Find().SetSort(bson.M{"number": -1}).SetLimit(int64(limit))
+
+	cursor, err := m.jobRuns.Find(ctx, bson.M{"job": name}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var runs []jobRun
+
+	if err := cursor.All(ctx, &runs); err != nil {
+		return nil, err
+	}
+
+	result := make([]*stepper.JobRun, 0, len(runs))
+	for i := range runs {
+		result = append(result, runs[i].ToModel())
+	}
+
+	return result, nil
 }
 
 func (m *Mongo) CreateTask(ctx context.Context, task *stepper.Task) error {
@@ -77,7 +315,106 @@ func (m *Mongo) SetState(ctx context.Context, task *stepper.Task, state []byte)
 	return nil
 }
 
-func (m *Mongo) FindNextTask(ctx context.Context, statuses []string) (*stepper.Task, error) {
+func (m *Mongo) SetMiddlewaresState(ctx context.Context, task *stepper.Task) error {
+	_, err := m.tasks.UpdateOne(ctx, bson.M{"id": task.ID}, bson.M{"$set": bson.M{"middlewares_state": task.MiddlewaresState}})
+
+	return err
+}
+
+func (m *Mongo) GetTask(ctx context.Context, id string) (*stepper.Task, error) {
+	var task Task
+
+	if err := m.tasks.FindOne(ctx, bson.M{"id": id}).Decode(&task); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return task.ToModel(), nil
+}
+
+func (m *Mongo) GetTaskChildren(ctx context.Context, parent string) ([]*stepper.Task, error) {
+	opts := options.Find().SetSort(bson.M{"id": 1})
+
+	cursor, err := m.tasks.Find(ctx, bson.M{"parent": parent}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var tasks []Task
+
+	if err := cursor.All(ctx, &tasks); err != nil {
+		return nil, err
+	}
+
+	result := make([]*stepper.Task, 0, len(tasks))
+	for i := range tasks {
+		result = append(result, tasks[i].ToModel())
+	}
+
+	return result, nil
+}
+
+func (m *Mongo) CreateSignal(ctx context.Context, model *stepper.Signal) error {
+	s := signal{}
+	s.FromModel(model)
+
+	if _, err := m.signals.InsertOne(ctx, s); err != nil {
+		return err
+	}
+
+	_, err := m.tasks.UpdateMany(
+		ctx,
+		bson.M{
+			"status": "suspended",
+			"$or":    bson.A{bson.M{"id": model.Target}, bson.M{"custom_id": model.Target}},
+		},
+		bson.M{"$set": bson.M{"launchAt": time.Now()}},
+	)
+
+	return err
+}
+
+func (m *Mongo) WakeTask(ctx context.Context, id string) error {
+	_, err := m.tasks.UpdateOne(
+		ctx,
+		bson.M{"id": id, "status": "suspended"},
+		bson.M{"$set": bson.M{"launchAt": time.Now()}},
+	)
+
+	return err
+}
+
+func (m *Mongo) GetSignals(ctx context.Context, task *stepper.Task, name string) ([]*stepper.Signal, error) {
+	targets := []string{task.ID}
+	if task.CustomId != "" {
+		targets = append(targets, task.CustomId)
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "id", Value: 1}})
+
+	cursor, err := m.signals.Find(ctx, bson.M{"target": bson.M{"$in": targets}, "name": name}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var signals []signal
+
+	if err := cursor.All(ctx, &signals); err != nil {
+		return nil, err
+	}
+
+	result := make([]*stepper.Signal, 0, len(signals))
+	for i := range signals {
+		result = append(result, signals[i].ToModel())
+	}
+
+	return result, nil
+}
+
+func (m *Mongo) FindNextTask(ctx context.Context, statuses []string, filter stepper.ClaimFilter) (*stepper.Task, error) {
 	var job Task
 
 	query := bson.M{
@@ -87,15 +424,49 @@ func (m *Mongo) FindNextTask(ctx context.Context, statuses []string) (*stepper.T
 		},
 		"$or": []bson.M{
 			{"lock_at": nil},
-			{"lock_at": bson.M{"$lte": time.Now().Add(5 * time.Minute * -1)}}, // TODO pass right timeout
+			{"lock_at": bson.M{"$lte": m.leaseExpiredAt()}},
 		},
 	}
 
-	update := bson.M{
-		"$set": bson.M{
+	if filter.Names != nil {
+		query["name"] = bson.M{"$in": filter.Names}
+	}
+
+	if filter.Tags != nil {
+		query["tags"] = tagsQuery(filter.Tags)
+
+		if filter.ExactTags && len(filter.Tags) > 0 {
+			query["tags"] = bson.M{"$all": filter.Tags, "$not": bson.M{"$elemMatch": bson.M{"$nin": filter.Tags}}}
+		}
+	}
+
+	if filter.Queues != nil {
+		queues := bson.A{}
+		for _, queue := range filter.Queues {
+			queues = append(queues, queue)
+
+			// tasks created before queues have no queue field
+			if queue == stepper.DefaultQueue {
+				queues = append(queues, nil)
+			}
+		}
+
+		query["queue"] = bson.M{"$in": queues}
+	}
+
+	isWaiting := bson.M{"$eq": bson.A{"$status", "waiting"}}
+
+	// a waiting task is only checked for its subtasks, so it is neither in progress nor launched again
+	update := bson.A{
+		bson.M{"$set": bson.M{
 			"lock_at": time.Now(),
-			"status":  "in_progress",
-		},
+			"status":  bson.M{"$cond": bson.A{isWaiting, "$status", "in_progress"}},
+			"attempt": bson.M{"$cond": bson.A{
+				isWaiting,
+				"$attempt",
+				bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$attempt", 0}}, 1}},
+			}},
+		}},
 	}
 
 	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
@@ -111,7 +482,7 @@ func (m *Mongo) FindNextTask(ctx context.Context, statuses []string) (*stepper.T
 	return job.ToModel(), nil
 }
 
-func (m *Mongo) FindNextJob(ctx context.Context, statuses []string) (*stepper.Job, error) {
+func (m *Mongo) FindNextJob(ctx context.Context, statuses []string, filter stepper.ClaimFilter) (*stepper.Job, error) {
 	var _job job
 
 	query := bson.M{
@@ -121,10 +492,18 @@ func (m *Mongo) FindNextJob(ctx context.Context, statuses []string) (*stepper.Jo
 		},
 		"$or": []bson.M{
 			{"lock_at": nil},
-			{"lock_at": bson.M{"$lte": time.Now().Add(time.Minute * -5)}}, // TODO pass right timeout
+			{"lock_at": bson.M{"$lte": m.leaseExpiredAt()}},
 		},
 	}
 
+	if filter.Names != nil {
+		query["name"] = bson.M{"$in": filter.Names}
+	}
+
+	if filter.Tags != nil {
+		query["tags"] = tagsQuery(filter.Tags)
+	}
+
 	update := bson.M{
 		"$set": bson.M{
 			"lock_at": time.Now(),
@@ -145,12 +524,19 @@ func (m *Mongo) FindNextJob(ctx context.Context, statuses []string) (*stepper.Jo
 	return _job.ToModel(), nil
 }
 
-func (m *Mongo) GetUnreleasedJobChildren(ctx context.Context, jobId string) (*stepper.Task, error) {
+func (m *Mongo) GetUnreleasedJobChildren(ctx context.Context, job *stepper.Job) (*stepper.Task, error) {
 	var task Task
 
 	query := bson.M{
-		"status": bson.M{"$in": []string{"created", "in_progress"}},
-		"jobId":  jobId,
+		"jobId": job.Name,
+		"$or": bson.A{
+			bson.M{"status": bson.M{"$in": []string{"created", "in_progress", "waiting", "suspended"}}},
+			bson.M{"status": "failed", "launchAt": bson.M{"$ne": nil}},
+		},
+	}
+
+	if job.RunId != "" {
+		query["jobRunId"] = job.RunId
 	}
 
 	if err := m.tasks.FindOne(ctx, query).Decode(&task); err != nil {
@@ -168,8 +554,11 @@ func (m *Mongo) GetUnreleasedTaskChildren(ctx context.Context, forTask *stepper.
 	var task Task
 
 	query := bson.M{
-		"status": bson.M{"$in": []string{"created", "in_progress"}},
 		"parent": forTask.ID,
+		"$or": bson.A{
+			bson.M{"status": bson.M{"$in": []string{"created", "in_progress", "waiting", "suspended"}}},
+			bson.M{"status": "failed", "launchAt": bson.M{"$ne": nil}},
+		},
 	}
 
 	if err := m.tasks.FindOne(ctx, query).Decode(&task); err != nil {
@@ -184,7 +573,15 @@ func (m *Mongo) GetUnreleasedTaskChildren(ctx context.Context, forTask *stepper.
 }
 
 func (m *Mongo) GetRelatedTask(ctx context.Context, task *stepper.Task) (*stepper.Task, error) {
-	query := bson.M{"custom_id": task.ID, "name": task.Name, "status": bson.M{"$ne": "released"}}
+	query := bson.M{
+		"custom_id": task.CustomId,
+		"name":      task.Name,
+		"id":        bson.M{"$lt": task.ID},
+		"$or": bson.A{
+			bson.M{"status": bson.M{"$in": []string{"created", "in_progress", "waiting", "suspended"}}},
+			bson.M{"status": "failed", "launchAt": bson.M{"$ne": nil}},
+		},
+	}
 
 	var e Task
 
@@ -199,14 +596,31 @@ func (m *Mongo) GetRelatedTask(ctx context.Context, task *stepper.Task) (*steppe
 	return e.ToModel(), nil
 }
 
+// keepPaused keeps the status of a job paused while it was claimed, the job is released by ResumeJob
+func keepPaused(status string) bson.M {
+	return bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$status", "paused"}}, "$status", status}}
+}
+
 func (m *Mongo) Release(ctx context.Context, job *stepper.Job, nextTimeLaunch time.Time) error {
 	return m.jobs.FindOneAndUpdate(
 		ctx,
 		bson.M{"name": job.Name},
-		bson.M{"$set": bson.M{
+		bson.A{bson.M{"$set": bson.M{
 			"lock_at":      nil,
-			"status":       "released",
+			"status":       keepPaused("released"),
 			"nextLaunchAt": nextTimeLaunch,
+			"launchDelay":  job.LaunchDelay,
+		}}},
+	).Err()
+}
+
+func (m *Mongo) RetireJob(ctx context.Context, job *stepper.Job) error {
+	return m.jobs.FindOneAndUpdate(
+		ctx,
+		bson.M{"name": job.Name},
+		bson.M{"$set": bson.M{
+			"lock_at": nil,
+			"status":  "retired",
 		}},
 	).Err()
 }
@@ -231,6 +645,80 @@ func (m *Mongo) FailTask(ctx context.Context, task *stepper.Task, handlerErr err
 	).Err()
 }
 
+func (m *Mongo) SuspendTask(ctx context.Context, task *stepper.Task, launchAt time.Time) error {
+	return m.tasks.FindOneAndUpdate(
+		ctx,
+		bson.M{"id": task.ID},
+		bson.M{
+			"$set": bson.M{
+				"lock_at":           nil,
+				"status":            "suspended",
+				"launchAt":          launchAt,
+				"middlewares_state": task.MiddlewaresState,
+			},
+			"$inc": bson.M{"attempt": -1},
+		},
+	).Err()
+}
+
+func (m *Mongo) DeadLetterTask(ctx context.Context, task *stepper.Task, err error) error {
+	return m.tasks.FindOneAndUpdate(
+		ctx,
+		bson.M{"id": task.ID},
+		bson.M{"$set": bson.M{
+			"launchAt": nil,
+			"lock_at":  nil,
+			"status":   "dead_letter",
+			"error":    err.Error(),
+		}},
+	).Err()
+}
+
+func (m *Mongo) CountDueTasks(ctx context.Context) ([]stepper.DueTasks, error) {
+	cursor, err := m.tasks.Aggregate(ctx, bson.A{
+		bson.M{"$match": bson.M{
+			"status":   bson.M{"$in": []string{"created", "failed", "suspended"}},
+			"launchAt": bson.M{"$lte": time.Now()},
+		}},
+		bson.M{"$group": bson.M{
+			"_id": bson.M{
+				"name":  "$name",
+				"queue": bson.M{"$ifNull": bson.A{"$queue", ""}},
+				"tags":  bson.M{"$ifNull": bson.A{"$tags", bson.A{}}},
+			},
+			"count": bson.M{"$sum": 1},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []struct {
+		ID struct {
+			Name  string   `bson:"name"`
+			Queue string   `bson:"queue"`
+			Tags  []string `bson:"tags"`
+		} `bson:"_id"`
+		Count int64 `bson:"count"`
+	}
+
+	if err := cursor.All(ctx, &groups); err != nil {
+		return nil, err
+	}
+
+	result := make([]stepper.DueTasks, 0, len(groups))
+	for _, group := range groups {
+		result = append(result, stepper.DueTasks{
+			Name:  group.ID.Name,
+			Queue: group.ID.Queue,
+			Tags:  group.ID.Tags,
+			Count: group.Count,
+		})
+	}
+
+	return result, nil
+}
+
 func (m *Mongo) ReleaseTask(ctx context.Context, task *stepper.Task) error {
 	return m.tasks.FindOneAndUpdate(
 		ctx,
@@ -246,11 +734,13 @@ func (m *Mongo) WaitForSubtasks(ctx context.Context, job *stepper.Job) error {
 	return m.jobs.FindOneAndUpdate(
 		ctx,
 		bson.M{"name": job.Name},
-		bson.M{"$set": bson.M{
+		bson.A{bson.M{"$set": bson.M{
 			"lock_at":      nil,
-			"status":       "waiting",
+			"status":       keepPaused("waiting"),
 			"nextLaunchAt": time.Now().Add(time.Second * 5),
-		}},
+			"scheduledAt":  job.ScheduledAt,
+			"runId":        job.RunId,
+		}}},
 	).Err()
 }
 
@@ -274,34 +764,92 @@ func (m *Mongo) Init(ctx context.Context) error {
 			Options: options.Index().SetBackground(true),
 		},
 		{
-			Keys:    bson.D{{"name", 1}, {"status", 1}, {"launchAt", 1}},
+			Keys:    bson.D{{Key: "name", Value: 1}, {Key: "status", Value: 1}, {Key: "launchAt", Value: 1}},
+			Options: options.Index().SetBackground(true),
+		},
+		{
+			Keys:    bson.M{"parent": 1},
 			Options: options.Index().SetBackground(true),
 		},
 	})
 
+	m.jobRuns.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.M{"id": 1},
+			Options: options.Index().SetBackground(true),
+		},
+		{
+			Keys:    bson.D{{Key: "job", Value: 1}, {Key: "number", Value: -1}},
+			Options: options.Index().SetBackground(true),
+		},
+	})
+
+	m.nodes.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.M{"id": 1},
+		Options: options.Index().SetBackground(true),
+	})
+
+	m.signals.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "target", Value: 1}, {Key: "name", Value: 1}},
+		Options: options.Index().SetBackground(true),
+	})
+
 	return nil
 }
 
-func (m *Mongo) CollectMetrics(ctx context.Context) error {
-	unreleasedCount, err := m.tasks.CountDocuments(ctx, bson.M{
-		"$or": bson.A{
-			bson.M{
-				"status":   "failed",
-				"launchAt": bson.M{"$ne": nil},
-			},
-			bson.M{
-				"status": bson.M{"$nin": []string{"failed", "released"}},
-				"launchAt": bson.M{
-					"$lte": time.Now(),
-				},
+func (m *Mongo) GetTaskStats(ctx context.Context) ([]stepper.TaskStats, error) {
+	dead := bson.M{"$and": bson.A{
+		bson.M{"$eq": bson.A{"$status", "failed"}},
+		bson.M{"$eq": bson.A{bson.M{"$ifNull": bson.A{"$launchAt", nil}}, nil}},
+	}}
+
+	due := bson.M{"$and": bson.A{
+		bson.M{"$in": bson.A{"$status", bson.A{"created", "failed", "suspended"}}},
+		bson.M{"$ne": bson.A{bson.M{"$ifNull": bson.A{"$launchAt", nil}}, nil}},
+		bson.M{"$lte": bson.A{"$launchAt", time.Now()}},
+	}}
+
+	cursor, err := m.tasks.Aggregate(ctx, bson.A{
+		bson.M{"$group": bson.M{
+			"_id": bson.M{
+				"name":   "$name",
+				"status": bson.M{"$cond": bson.A{dead, "dead", "$status"}},
 			},
-		},
+			"count":       bson.M{"$sum": 1},
+			"oldestDueAt": bson.M{"$min": bson.M{"$cond": bson.A{due, "$launchAt", nil}}},
+		}},
 	})
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	overallUnreleasedMetric.Set(float64(unreleasedCount))
+	var groups []struct {
+		ID struct {
+			Name   string `bson:"name"`
+			Status string `bson:"status"`
+		} `bson:"_id"`
+		Count       int64      `bson:"count"`
+		OldestDueAt *time.Time `bson:"oldestDueAt"`
+	}
 
-	return nil
+	if err := cursor.All(ctx, &groups); err != nil {
+		return nil, err
+	}
+
+	result := make([]stepper.TaskStats, 0, len(groups))
+	for _, group := range groups {
+		result = append(result, stepper.TaskStats{
+			Name:        group.ID.Name,
+			Status:      group.ID.Status,
+			Count:       group.Count,
+			OldestDueAt: lo.FromPtr(group.OldestDueAt),
+		})
+	}
+
+	return result, nil
+}
+
+// tagsQuery matches documents without tags or with tags from the list only
+func tagsQuery(tags []string) bson.M {
+	return bson.M{"$not": bson.M{"$elemMatch": bson.M{"$nin": tags}}}
 }
@@ -9,13 +9,16 @@ import (
 
 	"github.com/matroskin13/stepper"
 	"github.com/matroskin13/stepper/tests"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/xid"
+	"github.com/stretchr/testify/assert"
 	"go.mongodb.org/mongo-driver/event"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 func TestMongo(t *testing.T) {
-	tests.Run(t, func() stepper.Stepper {
+	tests.Run(t, func(options ...stepper.ServiceOption) stepper.Stepper {
 		db, err := createTestMongoDatabase("tests")
 		if err != nil {
 			log.Fatal(err)
@@ -23,10 +26,83 @@ func TestMongo(t *testing.T) {
 
 		mongoEngine := NewMongoWithDb(db)
 
-		return stepper.NewService(mongoEngine)
+		return stepper.NewService(mongoEngine, options...)
 	})
 }
 
+func TestMongoWithEngine(t *testing.T) {
+	db, err := createTestMongoDatabase("tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests.RunWithEngine(t, NewMongoWithDb(db))
+}
+
+func TestDeprecatedUnreleasedGauge(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db, err := createTestMongoDatabase("tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service := stepper.NewService(NewMongoWithDb(db), stepper.WithMetricsInterval(time.Millisecond*100))
+
+	// nobody handles the task, so it stays unreleased
+	assert.Nil(t, service.Publish(ctx, xid.New().String(), nil))
+
+	go service.Listen(ctx)
+
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(overallUnreleasedMetric) >= 1
+	}, time.Second*5, time.Millisecond*100, "the deprecated gauge must be updated by the service")
+}
+
+func TestLongHandlerIsNotClaimedAgain(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*20)
+	defer cancel()
+
+	db, err := createTestMongoDatabase("tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	engine := NewMongoWithDb(db, WithLeaseTimeout(time.Second))
+
+	name := xid.New().String()
+	started := make(chan struct{}, 10)
+	completed := make(chan struct{}, 10)
+
+	// two nodes compete for the task which runs longer than the lease timeout
+	for i := 0; i < 2; i++ {
+		service := stepper.NewService(engine)
+		service.TaskHandler(name, func(ctx stepper.Context, data []byte) error {
+			started <- struct{}{}
+			time.Sleep(time.Second * 3)
+			completed <- struct{}{}
+			return nil
+		})
+
+		go service.Listen(ctx)
+
+		if i == 0 {
+			assert.Nil(t, service.Publish(ctx, name, nil))
+		}
+	}
+
+	select {
+	case <-completed:
+	case <-ctx.Done():
+		t.Fatal("the task is not completed")
+	}
+
+	time.Sleep(time.Second * 2)
+
+	assert.Len(t, started, 1, "the task must be handled once")
+}
+
 func createTestMongoDatabase(dbName string) (*mongo.Database, error) {
 	cmdMonitor := &event.CommandMonitor{
 		Started: func(_ context.Context, evt *event.CommandStartedEvent) {
@@ -0,0 +1,36 @@
+package mongo
+
+import (
+	"time"
+
+	"github.com/matroskin13/stepper"
+)
+
+type node struct {
+	ID     string    `bson:"id"`
+	Jobs   []string  `bson:"jobs"`
+	Tasks  []string  `bson:"tasks"`
+	Queues []string  `bson:"queues"`
+	Tags   []string  `bson:"tags"`
+	SeenAt time.Time `bson:"seenAt"`
+}
+
+func (n *node) FromModel(model *stepper.Node) {
+	n.ID = model.ID
+	n.Jobs = model.Jobs
+	n.Tasks = model.Tasks
+	n.Queues = model.Queues
+	n.Tags = model.Tags
+	n.SeenAt = model.SeenAt
+}
+
+func (n *node) ToModel() *stepper.Node {
+	return &stepper.Node{
+		ID:     n.ID,
+		Jobs:   n.Jobs,
+		Tasks:  n.Tasks,
+		Queues: n.Queues,
+		Tags:   n.Tags,
+		SeenAt: n.SeenAt,
+	}
+}
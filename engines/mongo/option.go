@@ -0,0 +1,69 @@
+package mongo
+
+import "time"
+
+// Collections are names of the collections used by the engine, an empty name keeps the default one.
+type Collections struct {
+	Tasks   string
+	Jobs    string
+	JobRuns string
+	Nodes   string
+	Signals string
+}
+
+var DefaultCollections = Collections{
+	Tasks:   "tasks",
+	Jobs:    "jobs",
+	JobRuns: "job_runs",
+	Nodes:   "nodes",
+	Signals: "signals",
+}
+
+type Option func(c *config)
+
+type config struct {
+	prefix       string
+	collections  Collections
+	leaseTimeout time.Duration
+}
+
+// WithPrefix adds the prefix to the default names of all collections, so several deployments can share a database.
+func WithPrefix(prefix string) Option {
+	return func(c *config) {
+		c.prefix = prefix
+	}
+}
+
+// WithCollections overrides names of the collections. Collections which are not set keep the default names,
+// so nodes, job runs and signals are shared with other deployments unless WithPrefix is used.
+func WithCollections(collections Collections) Option {
+	return func(c *config) {
+		c.collections = collections
+	}
+}
+
+// WithLeaseTimeout sets the time after which tasks and jobs claimed by a stopped node are claimed again,
+// DefaultLeaseTimeout is used by default.
+func WithLeaseTimeout(timeout time.Duration) Option {
+	return func(c *config) {
+		c.leaseTimeout = timeout
+	}
+}
+
+func (c Collections) withDefaults(prefix string) Collections {
+	return Collections{
+		Tasks:   orDefault(c.Tasks, prefix+DefaultCollections.Tasks),
+		Jobs:    orDefault(c.Jobs, prefix+DefaultCollections.Jobs),
+		JobRuns: orDefault(c.JobRuns, prefix+DefaultCollections.JobRuns),
+		Nodes:   orDefault(c.Nodes, prefix+DefaultCollections.Nodes),
+		Signals: orDefault(c.Signals, prefix+DefaultCollections.Signals),
+	}
+}
+
+func orDefault(value, def string) string {
+	if value == "" {
+		return def
+	}
+
+	return value
+}
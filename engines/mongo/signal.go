@@ -0,0 +1,33 @@
+package mongo
+
+import (
+	"time"
+
+	"github.com/matroskin13/stepper"
+)
+
+type signal struct {
+	ID        string    `bson:"id"`
+	Target    string    `bson:"target"`
+	Name      string    `bson:"name"`
+	Payload   []byte    `bson:"payload"`
+	CreatedAt time.Time `bson:"createdAt"`
+}
+
+func (s *signal) FromModel(model *stepper.Signal) {
+	s.ID = model.ID
+	s.Target = model.Target
+	s.Name = model.Name
+	s.Payload = model.Payload
+	s.CreatedAt = model.CreatedAt
+}
+
+func (s *signal) ToModel() *stepper.Signal {
+	return &stepper.Signal{
+		ID:        s.ID,
+		Target:    s.Target,
+		Name:      s.Name,
+		Payload:   s.Payload,
+		CreatedAt: s.CreatedAt,
+	}
+}
@@ -12,12 +12,18 @@ type Task struct {
 	Name             string            `bson:"name"`
 	Data             []byte            `bson:"data"`
 	JobId            string            `bson:"jobId"`
+	JobRunId         string            `bson:"jobRunId"`
 	Parent           string            `bson:"parent"`
 	LaunchAt         time.Time         `bson:"launchAt"`
 	Status           string            `bson:"status"`
 	LockAt           *time.Time        `bson:"lock_at"`
 	State            []byte            `bson:"state"`
 	MiddlewaresState map[string][]byte `bson:"middlewares_state"`
+	Headers          map[string]string `bson:"headers"`
+	Tags             []string          `bson:"tags"`
+	Queue            string            `bson:"queue"`
+	Attempt          int               `bson:"attempt"`
+	TraceContext     map[string]string `bson:"traceContext"`
 }
 
 func (t *Task) FromModel(model *stepper.Task) {
@@ -26,12 +32,18 @@ func (t *Task) FromModel(model *stepper.Task) {
 	t.Name = model.Name
 	t.Data = model.Data
 	t.JobId = model.JobId
+	t.JobRunId = model.JobRunId
 	t.Parent = model.Parent
 	t.LaunchAt = model.LaunchAt
 	t.Status = model.Status
 	t.LockAt = model.LockAt
 	t.State = model.State
 	t.MiddlewaresState = model.MiddlewaresState
+	t.Headers = model.Headers
+	t.Tags = model.Tags
+	t.Queue = model.Queue
+	t.Attempt = model.Attempt
+	t.TraceContext = model.TraceContext
 }
 
 func (t *Task) ToModel() *stepper.Task {
@@ -40,6 +52,7 @@ func (t *Task) ToModel() *stepper.Task {
 		Name:             t.Name,
 		Data:             t.Data,
 		JobId:            t.JobId,
+		JobRunId:         t.JobRunId,
 		Parent:           t.Parent,
 		LaunchAt:         t.LaunchAt,
 		Status:           t.Status,
@@ -47,5 +60,10 @@ func (t *Task) ToModel() *stepper.Task {
 		State:            t.State,
 		MiddlewaresState: t.MiddlewaresState,
 		CustomId:         t.CustomId,
+		Headers:          t.Headers,
+		Tags:             t.Tags,
+		Queue:            t.Queue,
+		Attempt:          t.Attempt,
+		TraceContext:     t.TraceContext,
 	}
 }
@@ -1,8 +1,48 @@
 package pg
 
+import (
+	"time"
+
+	"github.com/matroskin13/stepper"
+	"github.com/samber/lo"
+)
+
 type Job struct {
-	Status       string `json:"status"`
-	Name         string `json:"name"`
-	Pattern      string `json:"pattern"`
-	NextLaunchAt int64  `json:"naxtLaunchAt"`
+	Status        string     `json:"status"`
+	Name          string     `json:"name"`
+	Tags          []string   `json:"tags"`
+	Pattern       string     `json:"pattern"`
+	Interval      *int64     `json:"interval"`
+	RunAt         *time.Time `json:"runAt"`
+	Jitter        *float64   `json:"jitter"`
+	Timezone      *string    `json:"timezone"`
+	MisfirePolicy *string    `json:"misfirePolicy"`
+	Overlap       *string    `json:"overlap"`
+	NextLaunchAt  time.Time  `json:"naxtLaunchAt"`
+	ScheduledAt   *time.Time `json:"scheduledAt"`
+	RunId         *string    `json:"runId"`
+	OrphanedAt    *time.Time `json:"orphanedAt"`
+	LaunchDelay   *int64     `json:"launchDelay"`
+	LockAt        *time.Time `json:"lockAt"`
+	LockedBy      *string    `json:"lockedBy"`
+}
+
+func (j *Job) ToModel() *stepper.Job {
+	return &stepper.Job{
+		Name:          j.Name,
+		Tags:          j.Tags,
+		Pattern:       j.Pattern,
+		Interval:      time.Duration(lo.FromPtr(j.Interval)),
+		Jitter:        lo.FromPtr(j.Jitter),
+		LaunchDelay:   time.Duration(lo.FromPtr(j.LaunchDelay)),
+		Timezone:      lo.FromPtr(j.Timezone),
+		MisfirePolicy: stepper.MisfirePolicy(lo.FromPtr(j.MisfirePolicy)),
+		Overlap:       stepper.OverlapPolicy(lo.FromPtr(j.Overlap)),
+		NextLaunchAt:  j.NextLaunchAt,
+		ScheduledAt:   lo.FromPtr(j.ScheduledAt),
+		RunAt:         lo.FromPtr(j.RunAt),
+		OrphanedAt:    lo.FromPtr(j.OrphanedAt),
+		Status:        j.Status,
+		RunId:         lo.FromPtr(j.RunId),
+	}
 }
@@ -0,0 +1,34 @@
+package pg
+
+import (
+	"time"
+
+	"github.com/matroskin13/stepper"
+	"github.com/samber/lo"
+)
+
+type JobRun struct {
+	ID             string     `json:"id"`
+	Job            string     `json:"job"`
+	TaskId         string     `json:"taskId"`
+	Number         int        `json:"number"`
+	Status         string     `json:"status"`
+	PreviousStatus string     `json:"previousStatus"`
+	ScheduledAt    time.Time  `json:"scheduledAt"`
+	StartedAt      *time.Time `json:"startedAt"`
+	FinishedAt     *time.Time `json:"finishedAt"`
+}
+
+func (r *JobRun) ToModel() *stepper.JobRun {
+	return &stepper.JobRun{
+		ID:             r.ID,
+		Job:            r.Job,
+		TaskId:         r.TaskId,
+		Number:         r.Number,
+		Status:         r.Status,
+		PreviousStatus: r.PreviousStatus,
+		ScheduledAt:    r.ScheduledAt,
+		StartedAt:      lo.FromPtr(r.StartedAt),
+		FinishedAt:     lo.FromPtr(r.FinishedAt),
+	}
+}
@@ -0,0 +1,97 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/matroskin13/stepper"
+	"github.com/rs/xid"
+)
+
+// ErrLeaseLost is returned when a task or a job was claimed by another node after the lease of this node expired.
+var ErrLeaseLost = errors.New("lease is lost")
+
+// DefaultLeaseTimeout is the time after which a claimed task or job can be claimed again,
+// the lease of a task is renewed while its handler is running.
+const DefaultLeaseTimeout = 5 * time.Minute
+
+type _ctxKey string
+
+var ctxKey = "__ctx:stepper:pg"
+
+func (pg *PG) newLease(ctx context.Context) (context.Context, string) {
+	owner := xid.New().String()
+
+	return context.WithValue(ctx, _ctxKey(ctxKey), owner), owner
+}
+
+// leaseExpiredAt returns the time before which leases are expired
+func (pg *PG) leaseExpiredAt() time.Time {
+	return time.Now().Add(-pg.leaseTimeout)
+}
+
+func leaseOwner(ctx context.Context) (string, error) {
+	if ctx == nil {
+		return "", errors.New("cannot get pg lease")
+	}
+
+	owner, ok := ctx.Value(_ctxKey(ctxKey)).(string)
+	if !ok {
+		return "", errors.New("cannot get pg lease")
+	}
+
+	return owner, nil
+}
+
+// execLeased executes the update only if the row is still claimed by the lease of engineCtx,
+// the lease is released by the update if release is set.
+func (pg *PG) execLeased(ctx context.Context, engineCtx context.Context, query sq.UpdateBuilder, release bool) error {
+	owner, err := leaseOwner(engineCtx)
+	if err != nil {
+		return err
+	}
+
+	query = query.Where(sq.Eq{"locked_by": owner}).PlaceholderFormat(sq.Dollar)
+
+	if release {
+		query = query.Set("lock_at", nil).Set("locked_by", nil)
+	}
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return err
+	}
+
+	tag, err := pg.pool.Exec(ctx, sql, args...)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrLeaseLost
+	}
+
+	return nil
+}
+
+// KeepTaskLease bumps lock_at of the claimed task every third of the lease timeout until the context is done,
+// ErrLeaseLost is returned if the task was claimed by another node.
+func (pg *PG) KeepTaskLease(ctx context.Context, task *stepper.Task) error {
+	ticker := time.NewTicker(pg.leaseTimeout / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			query := sq.Update(pg.tasks).Set("lock_at", time.Now()).Where(sq.Eq{"id": task.ID})
+
+			if err := pg.execLeased(ctx, task.EngineContext, query, false); err != nil {
+				return err
+			}
+		}
+	}
+}
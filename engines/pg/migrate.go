@@ -0,0 +1,159 @@
+package pg
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/jackc/pgx/v5"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockKey is a key of the advisory lock which prevents concurrent migrations from several nodes
+const migrationLockKey = 4_715_839_301
+
+// migrationData is available in templates of migrations, tables are quoted and qualified by the schema
+type migrationData struct {
+	Tasks   string
+	Jobs    string
+	JobRuns string
+	Nodes   string
+	Signals string
+	Names   Tables
+	// Legacy is set when the tables can be created by versions without migrations
+	Legacy bool
+}
+
+var migrationFuncs = template.FuncMap{
+	// ident joins parts into a quoted name of an index or a constraint
+	"ident": func(parts ...string) string {
+		return pgx.Identifier{strings.Join(parts, "")}.Sanitize()
+	},
+}
+
+type migration struct {
+	Version int
+	Name    string
+	SQL     *template.Template
+}
+
+func loadMigrations() ([]migration, error) {
+	entries, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]migration, 0, len(entries))
+
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".sql")
+
+		version, err := strconv.Atoi(strings.SplitN(name, "_", 2)[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration name=%s: %w", entry.Name(), err)
+		}
+
+		sql, err := migrationFiles.ReadFile(path.Join("migrations", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		tmpl, err := template.New(name).Funcs(migrationFuncs).Parse(string(sql))
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration name=%s: %w", entry.Name(), err)
+		}
+
+		migrations = append(migrations, migration{Version: version, Name: name, SQL: tmpl})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// migrate applies migrations which are not applied yet, every migration is applied in its own transaction.
+func (pg *PG) migrate(ctx context.Context) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	conn, err := pg.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Release()
+
+	// the lock belongs to the session, so all statements must use the same connection
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey); err != nil {
+		return fmt.Errorf("cannot acquire migration lock: %w", err)
+	}
+
+	defer conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockKey)
+
+	if pg.schema != "" {
+		if _, err := conn.Exec(ctx, "CREATE SCHEMA IF NOT EXISTS "+pgx.Identifier{pg.schema}.Sanitize()); err != nil {
+			return err
+		}
+	}
+
+	if _, err := conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS `+pg.schemaVersion+` (
+		version INT PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`); err != nil {
+		return err
+	}
+
+	var current int
+
+	if err := conn.QueryRow(ctx, "SELECT coalesce(max(version), 0) FROM "+pg.schemaVersion).Scan(&current); err != nil {
+		return err
+	}
+
+	data := migrationData{
+		Tasks:   pg.tasks,
+		Jobs:    pg.jobs,
+		JobRuns: pg.jobRuns,
+		Nodes:   pg.nodes,
+		Signals: pg.signals,
+		Names:   pg.names,
+		Legacy:  pg.schema == "" && pg.names.Tasks == DefaultTables.Tasks,
+	}
+
+	for _, m := range migrations {
+		if m.Version <= current {
+			continue
+		}
+
+		var sql strings.Builder
+
+		if err := m.SQL.Execute(&sql, data); err != nil {
+			return fmt.Errorf("cannot render migration=%s: %w", m.Name, err)
+		}
+
+		if err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+			if _, err := tx.Exec(ctx, sql.String()); err != nil {
+				return err
+			}
+
+			_, err := tx.Exec(ctx, "INSERT INTO "+pg.schemaVersion+" (version, name) VALUES ($1, $2)", m.Version, m.Name)
+
+			return err
+		}); err != nil {
+			return fmt.Errorf("cannot apply migration=%s: %w", m.Name, err)
+		}
+	}
+
+	return nil
+}
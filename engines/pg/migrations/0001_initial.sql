@@ -0,0 +1,89 @@
+-- The schema created by Init before versioned migrations. Every statement is idempotent,
+-- so the migration can be applied to databases created by older versions.
+-- Names of tables are templates, see migrationData.
+
+CREATE TABLE IF NOT EXISTS {{.Tasks}} (
+    id TEXT,
+    custom_id TEXT,
+    name TEXT,
+    data TEXT,
+    job_id TEXT,
+    parent TEXT,
+    launch_at bigint,
+    status TEXT,
+    lock_at DATE,
+    state TEXT,
+    middlewares_state TEXT,
+    error TEXT
+);
+
+ALTER TABLE {{.Tasks}} ADD COLUMN IF NOT EXISTS headers TEXT;
+
+ALTER TABLE {{.Tasks}} ADD COLUMN IF NOT EXISTS job_run_id TEXT;
+
+ALTER TABLE {{.Tasks}} ADD COLUMN IF NOT EXISTS tags TEXT[];
+
+ALTER TABLE {{.Tasks}} ADD COLUMN IF NOT EXISTS queue TEXT;
+
+CREATE TABLE IF NOT EXISTS {{.Jobs}} (
+    name TEXT UNIQUE,
+    status TEXT,
+    next_launch_at BIGINT,
+    pattern TEXT
+);
+
+ALTER TABLE {{.Jobs}} ADD COLUMN IF NOT EXISTS timezone TEXT;
+
+ALTER TABLE {{.Jobs}} ADD COLUMN IF NOT EXISTS misfire_policy TEXT;
+
+ALTER TABLE {{.Jobs}} ADD COLUMN IF NOT EXISTS scheduled_at BIGINT;
+
+ALTER TABLE {{.Jobs}} ADD COLUMN IF NOT EXISTS run_id TEXT;
+
+ALTER TABLE {{.Jobs}} ADD COLUMN IF NOT EXISTS orphaned_at BIGINT;
+
+ALTER TABLE {{.Jobs}} ADD COLUMN IF NOT EXISTS overlap TEXT;
+
+ALTER TABLE {{.Jobs}} ADD COLUMN IF NOT EXISTS interval BIGINT;
+
+ALTER TABLE {{.Jobs}} ADD COLUMN IF NOT EXISTS run_at BIGINT;
+
+ALTER TABLE {{.Jobs}} ADD COLUMN IF NOT EXISTS jitter DOUBLE PRECISION;
+
+ALTER TABLE {{.Jobs}} ADD COLUMN IF NOT EXISTS launch_delay BIGINT;
+
+ALTER TABLE {{.Jobs}} ADD COLUMN IF NOT EXISTS tags TEXT[];
+
+CREATE TABLE IF NOT EXISTS {{.Nodes}} (
+    id TEXT UNIQUE,
+    jobs TEXT[],
+    seen_at BIGINT
+);
+
+ALTER TABLE {{.Nodes}} ADD COLUMN IF NOT EXISTS tasks TEXT[];
+
+CREATE TABLE IF NOT EXISTS {{.JobRuns}} (
+    id TEXT UNIQUE,
+    job TEXT,
+    task_id TEXT,
+    number BIGINT,
+    status TEXT,
+    previous_status TEXT,
+    scheduled_at BIGINT,
+    started_at BIGINT,
+    finished_at BIGINT
+);
+
+CREATE INDEX IF NOT EXISTS {{ident "idx_" .Names.JobRuns "_job"}} ON {{.JobRuns}}(job, number);
+
+CREATE TABLE IF NOT EXISTS {{.Signals}} (
+    id TEXT,
+    target TEXT,
+    name TEXT,
+    payload TEXT,
+    created_at BIGINT
+);
+
+CREATE INDEX IF NOT EXISTS {{ident "idx_" .Names.Signals "_target"}} ON {{.Signals}}(target, name);
+
+CREATE INDEX IF NOT EXISTS {{ident "idx_" .Names.Tasks "_full"}} ON {{.Tasks}}(name, status, launch_at);
@@ -0,0 +1,53 @@
+-- Moves from TEXT and nanoseconds in BIGINT to proper types, adds primary keys and indexes.
+-- Durations (jobs.interval, jobs.launch_delay) are kept in nanoseconds.
+
+ALTER TABLE {{.Tasks}}
+    ALTER COLUMN data TYPE BYTEA USING convert_to(data, 'UTF8'),
+    ALTER COLUMN launch_at TYPE TIMESTAMPTZ USING to_timestamp(launch_at::double precision / 1000000000),
+    ALTER COLUMN lock_at TYPE TIMESTAMPTZ USING lock_at::timestamptz,
+    ALTER COLUMN state TYPE BYTEA USING convert_to(state, 'UTF8'),
+    ALTER COLUMN middlewares_state TYPE JSONB USING nullif(middlewares_state, '')::jsonb,
+    ALTER COLUMN headers TYPE JSONB USING nullif(headers, '')::jsonb;
+
+ALTER TABLE {{.Tasks}} ADD PRIMARY KEY (id);
+
+{{if .Legacy}}
+DROP INDEX IF EXISTS idx_id;
+DROP INDEX IF EXISTS idx_parent;
+DROP INDEX IF EXISTS idx_full;
+{{end}}
+
+CREATE INDEX IF NOT EXISTS {{ident "idx_" .Names.Tasks "_parent"}} ON {{.Tasks}}(parent);
+CREATE INDEX IF NOT EXISTS {{ident "idx_" .Names.Tasks "_job"}} ON {{.Tasks}}(job_id, job_run_id);
+CREATE INDEX IF NOT EXISTS {{ident "idx_" .Names.Tasks "_custom_id"}} ON {{.Tasks}}(custom_id);
+CREATE INDEX IF NOT EXISTS {{ident "idx_" .Names.Tasks "_status"}} ON {{.Tasks}}(status, launch_at);
+
+ALTER TABLE {{.Jobs}}
+    ALTER COLUMN next_launch_at TYPE TIMESTAMPTZ USING to_timestamp(next_launch_at::double precision / 1000000000),
+    ALTER COLUMN scheduled_at TYPE TIMESTAMPTZ USING to_timestamp(scheduled_at::double precision / 1000000000),
+    ALTER COLUMN orphaned_at TYPE TIMESTAMPTZ USING to_timestamp(orphaned_at::double precision / 1000000000),
+    ALTER COLUMN run_at TYPE TIMESTAMPTZ USING to_timestamp(run_at::double precision / 1000000000);
+
+ALTER TABLE {{.Jobs}} DROP CONSTRAINT IF EXISTS {{ident .Names.Jobs "_name_key"}};
+ALTER TABLE {{.Jobs}} ADD PRIMARY KEY (name);
+
+CREATE INDEX IF NOT EXISTS {{ident "idx_" .Names.Jobs "_status"}} ON {{.Jobs}}(status, next_launch_at);
+
+ALTER TABLE {{.Nodes}} ALTER COLUMN seen_at TYPE TIMESTAMPTZ USING to_timestamp(seen_at::double precision / 1000000000);
+
+ALTER TABLE {{.Nodes}} DROP CONSTRAINT IF EXISTS {{ident .Names.Nodes "_id_key"}};
+ALTER TABLE {{.Nodes}} ADD PRIMARY KEY (id);
+
+ALTER TABLE {{.JobRuns}}
+    ALTER COLUMN scheduled_at TYPE TIMESTAMPTZ USING to_timestamp(scheduled_at::double precision / 1000000000),
+    ALTER COLUMN started_at TYPE TIMESTAMPTZ USING to_timestamp(started_at::double precision / 1000000000),
+    ALTER COLUMN finished_at TYPE TIMESTAMPTZ USING to_timestamp(finished_at::double precision / 1000000000);
+
+ALTER TABLE {{.JobRuns}} DROP CONSTRAINT IF EXISTS {{ident .Names.JobRuns "_id_key"}};
+ALTER TABLE {{.JobRuns}} ADD PRIMARY KEY (id);
+
+ALTER TABLE {{.Signals}}
+    ALTER COLUMN payload TYPE BYTEA USING convert_to(payload, 'UTF8'),
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ USING to_timestamp(created_at::double precision / 1000000000);
+
+ALTER TABLE {{.Signals}} ADD PRIMARY KEY (id);
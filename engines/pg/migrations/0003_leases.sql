@@ -0,0 +1,7 @@
+-- Tasks and jobs are claimed with a lease instead of a transaction held by the handler.
+
+ALTER TABLE {{.Tasks}} ADD COLUMN IF NOT EXISTS locked_by TEXT;
+
+ALTER TABLE {{.Jobs}} ADD COLUMN IF NOT EXISTS lock_at TIMESTAMPTZ;
+
+ALTER TABLE {{.Jobs}} ADD COLUMN IF NOT EXISTS locked_by TEXT;
@@ -0,0 +1,5 @@
+-- Tasks count their launches and carry a trace context of the publisher.
+
+ALTER TABLE {{.Tasks}} ADD COLUMN IF NOT EXISTS attempt INT NOT NULL DEFAULT 0;
+
+ALTER TABLE {{.Tasks}} ADD COLUMN IF NOT EXISTS trace_context JSONB;
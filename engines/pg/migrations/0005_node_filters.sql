@@ -0,0 +1,5 @@
+-- Nodes report their queues and tags, so tasks which no node can claim are detected.
+
+ALTER TABLE {{.Nodes}} ADD COLUMN IF NOT EXISTS queues TEXT[];
+
+ALTER TABLE {{.Nodes}} ADD COLUMN IF NOT EXISTS tags TEXT[];
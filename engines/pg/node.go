@@ -0,0 +1,27 @@
+package pg
+
+import (
+	"time"
+
+	"github.com/matroskin13/stepper"
+)
+
+type Node struct {
+	ID     string    `json:"id"`
+	Jobs   []string  `json:"jobs"`
+	Tasks  []string  `json:"tasks"`
+	Queues []string  `json:"queues"`
+	Tags   []string  `json:"tags"`
+	SeenAt time.Time `json:"seenAt"`
+}
+
+func (n *Node) ToModel() *stepper.Node {
+	return &stepper.Node{
+		ID:     n.ID,
+		Jobs:   n.Jobs,
+		Tasks:  n.Tasks,
+		Queues: n.Queues,
+		Tags:   n.Tags,
+		SeenAt: n.SeenAt,
+	}
+}
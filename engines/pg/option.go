@@ -0,0 +1,101 @@
+package pg
+
+import (
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Tables are names of the tables used by the engine, an empty name keeps the default one.
+type Tables struct {
+	Tasks         string
+	Jobs          string
+	JobRuns       string
+	Nodes         string
+	Signals       string
+	SchemaVersion string
+}
+
+var DefaultTables = Tables{
+	Tasks:         "tasks",
+	Jobs:          "jobs",
+	JobRuns:       "job_runs",
+	Nodes:         "nodes",
+	Signals:       "signals",
+	SchemaVersion: "stepper_schema_version",
+}
+
+type Option func(c *config)
+
+type config struct {
+	schema       string
+	prefix       string
+	tables       Tables
+	leaseTimeout time.Duration
+}
+
+// WithSchema puts the tables into the schema, the schema is created by Init if it does not exist.
+func WithSchema(schema string) Option {
+	return func(c *config) {
+		c.schema = schema
+	}
+}
+
+// WithPrefix adds the prefix to the default names of all tables, so several deployments can share a database.
+func WithPrefix(prefix string) Option {
+	return func(c *config) {
+		c.prefix = prefix
+	}
+}
+
+// WithTables overrides names of the tables. Tables which are not set keep the default names,
+// so nodes, job runs and signals are shared with other deployments unless WithPrefix is used.
+func WithTables(tables Tables) Option {
+	return func(c *config) {
+		c.tables = tables
+	}
+}
+
+// WithLeaseTimeout sets the time after which tasks and jobs claimed by a stopped node are claimed again,
+// DefaultLeaseTimeout is used by default.
+func WithLeaseTimeout(timeout time.Duration) Option {
+	return func(c *config) {
+		c.leaseTimeout = timeout
+	}
+}
+
+func (t Tables) withDefaults(prefix string) Tables {
+	names := Tables{
+		Tasks:   orDefault(t.Tasks, prefix+DefaultTables.Tasks),
+		Jobs:    orDefault(t.Jobs, prefix+DefaultTables.Jobs),
+		JobRuns: orDefault(t.JobRuns, prefix+DefaultTables.JobRuns),
+		Nodes:   orDefault(t.Nodes, prefix+DefaultTables.Nodes),
+		Signals: orDefault(t.Signals, prefix+DefaultTables.Signals),
+	}
+
+	// the version belongs to the tasks table, otherwise a deployment with other tables
+	// in the same schema would skip migrations applied by another deployment
+	names.SchemaVersion = orDefault(t.SchemaVersion, DefaultTables.SchemaVersion)
+	if t.SchemaVersion == "" && names.Tasks != DefaultTables.Tasks {
+		names.SchemaVersion = names.Tasks + "_schema_version"
+	}
+
+	return names
+}
+
+func orDefault(value, def string) string {
+	if value == "" {
+		return def
+	}
+
+	return value
+}
+
+// table returns a quoted name of the table, qualified by the schema if it is set
+func (c *config) table(name string) string {
+	if c.schema == "" {
+		return pgx.Identifier{name}.Sanitize()
+	}
+
+	return pgx.Identifier{c.schema, name}.Sanitize()
+}
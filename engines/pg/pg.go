@@ -11,20 +11,36 @@ import (
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/matroskin13/stepper"
+	"github.com/samber/lo"
 
 	sq "github.com/Masterminds/squirrel"
 )
 
-type _ctxKey string
-
-var ctxKey = "__ctx:stepper:pg"
-
 type PG struct {
 	pool *pgxpool.Pool
+
+	schema        string
+	names         Tables
+	tasks         string
+	jobs          string
+	jobRuns       string
+	nodes         string
+	signals       string
+	schemaVersion string
+
+	leaseTimeout time.Duration
 }
 
-func NewPG(host string) (*PG, error) {
-	ctx, _ := context.WithTimeout(context.Background(), time.Second*10)
+func NewPG(host string, opts ...Option) (*PG, error) {
+	c := config{}
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	names := c.tables.withDefaults(c.prefix)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
 
 	conn, err := pgxpool.New(ctx, host)
 	if err != nil {
@@ -36,155 +52,246 @@ func NewPG(host string) (*PG, error) {
 	}
 
 	return &PG{
-		pool: conn,
+		pool:          conn,
+		schema:        c.schema,
+		names:         names,
+		tasks:         c.table(names.Tasks),
+		jobs:          c.table(names.Jobs),
+		jobRuns:       c.table(names.JobRuns),
+		nodes:         c.table(names.Nodes),
+		signals:       c.table(names.Signals),
+		schemaVersion: c.table(names.SchemaVersion),
+		leaseTimeout:  lo.Ternary(c.leaseTimeout == 0, DefaultLeaseTimeout, c.leaseTimeout),
 	}, nil
 }
 
+// Init creates or migrates the schema, it is safe to call Init from several nodes at the same time.
 func (pg *PG) Init(ctx context.Context) error {
-	if _, err := pg.pool.Exec(ctx, `CREATE TABLE IF NOT EXISTS tasks (
-		id TEXT,
-		custom_id TEXT,
-		name TEXT,
-		data TEXT,
-		job_id TEXT,
-		parent TEXT,
-		launch_at bigint,
-		status TEXT,
-		lock_at DATE,
-		state TEXT,
-		middlewares_state TEXT,
-		error TEXT
-	)`); err != nil {
-		return err
-	}
+	return pg.migrate(ctx)
+}
 
-	if _, err := pg.pool.Exec(ctx, `CREATE TABLE IF NOT EXISTS jobs (
-		name TEXT UNIQUE,
-		status TEXT,
-		next_launch_at BIGINT,
-		pattern TEXT
-	)`); err != nil {
-		return err
+func (pg *PG) Close() {
+	pg.pool.Close()
+}
+
+func (pg *PG) GetTaskStats(ctx context.Context) ([]stepper.TaskStats, error) {
+	var groups []struct {
+		Name        string
+		Status      string
+		Count       int64
+		OldestDueAt *time.Time
 	}
 
-	if _, err := pg.pool.Exec(ctx, `CREATE INDEX IF NOT EXISTS idx_full ON tasks(name, status, launch_at)`); err != nil {
-		return err
+	if err := pgxscan.Select(
+		ctx,
+		pg.pool,
+		&groups,
+		`SELECT
+			name,
+			CASE WHEN status = 'failed' AND launch_at IS NULL THEN 'dead' ELSE status END AS status,
+			count(*) AS count,
+			min(launch_at) FILTER (WHERE status = ANY($1) AND launch_at <= $2) AS oldest_due_at
+		FROM `+pg.tasks+` GROUP BY 1, 2`,
+		[]string{"created", "failed", "suspended"},
+		time.Now(),
+	); err != nil {
+		return nil, err
 	}
 
-	if _, err := pg.pool.Exec(ctx, `CREATE INDEX IF NOT EXISTS idx_id ON tasks(id)`); err != nil {
-		return err
+	result := make([]stepper.TaskStats, 0, len(groups))
+	for _, group := range groups {
+		result = append(result, stepper.TaskStats{
+			Name:        group.Name,
+			Status:      group.Status,
+			Count:       group.Count,
+			OldestDueAt: lo.FromPtr(group.OldestDueAt),
+		})
 	}
 
-	return nil
+	return result, nil
 }
 
-func (pg *PG) Close() {
-	pg.pool.Close()
-}
+func (pg *PG) GetRelatedTask(ctx context.Context, task *stepper.Task) (*stepper.Task, error) {
+	var related Task
 
-func (pg *PG) CollectMetrics(ctx context.Context) error {
-	return nil
+	// ids are compared bytewise, so they are ordered by the time of publishing
+	if err := pgxscan.Get(
+		ctx,
+		pg.pool,
+		&related,
+		`SELECT * FROM `+pg.tasks+` WHERE custom_id = $1 AND name = $2 AND id COLLATE "C" < $3
+			AND (status = ANY($4) OR (status = 'failed' AND launch_at IS NOT NULL))
+		ORDER BY id LIMIT 1`,
+		task.CustomId,
+		task.Name,
+		task.ID,
+		[]string{"created", "in_progress", "waiting", "suspended"},
+	); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return related.ToModel(), nil
 }
 
-func (pg *PG) GetRelatedTask(ctx context.Context, task *stepper.Task) (*stepper.Task, error) {
-	return nil, nil
+func (pg *PG) GetTask(ctx context.Context, id string) (*stepper.Task, error) {
+	var task Task
+
+	if err := pgxscan.Get(ctx, pg.pool, &task, "SELECT * FROM "+pg.tasks+" WHERE id = $1 LIMIT 1", id); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return task.ToModel(), nil
 }
 
-func (pg *PG) FindNextTask(ctx context.Context, statuses []string) (*stepper.Task, error) {
-	tx, err := pg.pool.BeginTx(ctx, pgx.TxOptions{})
-	if err != nil {
+func (pg *PG) GetTaskChildren(ctx context.Context, parent string) ([]*stepper.Task, error) {
+	var tasks []Task
+
+	if err := pgxscan.Select(ctx, pg.pool, &tasks, "SELECT * FROM "+pg.tasks+" WHERE parent = $1 ORDER BY id", parent); err != nil {
 		return nil, err
 	}
 
+	result := make([]*stepper.Task, 0, len(tasks))
+	for i := range tasks {
+		result = append(result, tasks[i].ToModel())
+	}
+
+	return result, nil
+}
+
+// FindNextTask claims a task in a short transaction, the lease of the task is kept in Task.EngineContext.
+func (pg *PG) FindNextTask(ctx context.Context, statuses []string, filter stepper.ClaimFilter) (*stepper.Task, error) {
+	engineCtx, owner := pg.newLease(ctx)
+
 	var task Task
 
 	if err := pgxscan.Get(
 		ctx,
-		tx,
+		pg.pool,
 		&task,
-		"SELECT * FROM tasks WHERE launch_at <= $2 AND status = ANY($1) ORDER BY id LIMIT 1 FOR UPDATE SKIP LOCKED",
+		`UPDATE `+pg.tasks+` SET
+			status = CASE WHEN status = 'waiting' THEN status ELSE 'in_progress' END,
+			attempt = CASE WHEN status = 'waiting' THEN attempt ELSE attempt + 1 END,
+			lock_at = $2,
+			locked_by = $7
+		WHERE id = (
+			SELECT id FROM `+pg.tasks+` WHERE launch_at <= $2 AND status = ANY($1) AND ($3::text[] IS NULL OR coalesce(tags, '{}') <@ $3)
+				AND ($4::text[] IS NULL OR name = ANY($4))
+				AND ($5::text[] IS NULL OR coalesce(queue, '') = ANY($5))
+				AND (lock_at IS NULL OR lock_at <= $6)
+				AND (NOT $8 OR coalesce(tags, '{}') @> $3)
+			ORDER BY id LIMIT 1 FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
 		statuses,
-		time.Now().UnixNano(),
+		time.Now(),
+		filter.Tags,
+		filter.Names,
+		filter.Queues,
+		pg.leaseExpiredAt(),
+		owner,
+		filter.ExactTags && filter.Tags != nil,
 	); err != nil {
-
 		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, tx.Commit(ctx)
+			return nil, nil
 		}
 
-		tx.Rollback(ctx)
-
 		return nil, fmt.Errorf("cannot find task: %w", err)
 	}
 
 	res := task.ToModel()
 
-	res.EngineContext = context.WithValue(ctx, _ctxKey(ctxKey), tx)
+	res.EngineContext = engineCtx
 
 	return res, nil
 }
 
-func (pg *PG) ReleaseTask(ctx context.Context, task *stepper.Task) error {
-	tx, err := pg.getTx(task.EngineContext)
-	if err != nil {
-		return err
-	}
+func (pg *PG) DeadLetterTask(ctx context.Context, task *stepper.Task, err error) error {
+	query := sq.
+		Update(pg.tasks).
+		Set("status", "dead_letter").
+		Set("launch_at", nil).
+		Set("error", err.Error()).
+		Where(sq.Eq{"id": task.ID})
 
-	if _, err := tx.Exec(ctx, "UPDATE tasks SET status = 'released' WHERE id = $1", task.ID); err != nil {
-		tx.Rollback(ctx)
-		return err
+	return pg.execLeased(ctx, task.EngineContext, query, true)
+}
+
+func (pg *PG) CountDueTasks(ctx context.Context) ([]stepper.DueTasks, error) {
+	var groups []stepper.DueTasks
+
+	if err := pgxscan.Select(
+		ctx,
+		pg.pool,
+		&groups,
+		`SELECT name, coalesce(queue, '') AS queue, coalesce(tags, '{}') AS tags, count(*) AS count
+		FROM `+pg.tasks+` WHERE status = ANY($1) AND launch_at <= $2 GROUP BY 1, 2, 3`,
+		[]string{"created", "failed", "suspended"},
+		time.Now(),
+	); err != nil {
+		return nil, err
 	}
 
-	tx.Commit(ctx)
+	return groups, nil
+}
+
+func (pg *PG) ReleaseTask(ctx context.Context, task *stepper.Task) error {
+	query := sq.Update(pg.tasks).Set("status", "released").Where(sq.Eq{"id": task.ID})
 
-	return nil
+	return pg.execLeased(ctx, task.EngineContext, query, true)
 }
 
 func (pg *PG) WaitTaskForSubtasks(ctx context.Context, task *stepper.Task) error {
-	return pg.runTX(task.EngineContext, func(tx pgx.Tx) error {
-		_, err := tx.Exec(
-			ctx,
-			"UPDATE tasks SET status = 'waiting', launch_at = $1 WHERE id = $2",
-			time.Now().Add(time.Second*1).UnixNano(),
-			task.ID,
-		)
+	query := sq.
+		Update(pg.tasks).
+		Set("status", "waiting").
+		Set("launch_at", time.Now().Add(time.Second*1)).
+		Where(sq.Eq{"id": task.ID})
 
-		return err
-	})
+	return pg.execLeased(ctx, task.EngineContext, query, true)
 }
 
 func (pg *PG) FailTask(ctx context.Context, task *stepper.Task, err error, timeout time.Duration) error {
-	return pg.runTX(task.EngineContext, func(tx pgx.Tx) error {
-		ms, _ := json.Marshal(task.MiddlewaresState)
-
-		query := sq.
-			Update("tasks").
-			Set("status", "failed").
-			Set("error", err.Error()).
-			Set("middlewares_state", string(ms)).
-			Where(sq.Eq{"id": task.ID}).
-			PlaceholderFormat(sq.Dollar)
-
-		if timeout != -1 {
-			query = query.Set("launch_at", time.Now().Add(timeout).UnixNano())
-		} else {
-			query = query.Set("launch_at", nil)
-		}
+	ms, _ := json.Marshal(task.MiddlewaresState)
+
+	query := sq.
+		Update(pg.tasks).
+		Set("status", "failed").
+		Set("error", err.Error()).
+		Set("middlewares_state", string(ms)).
+		Where(sq.Eq{"id": task.ID})
+
+	if timeout != -1 {
+		query = query.Set("launch_at", time.Now().Add(timeout))
+	} else {
+		query = query.Set("launch_at", nil)
+	}
 
-		sql, args, err := query.ToSql()
-		if err != nil {
-			return err
-		}
+	return pg.execLeased(ctx, task.EngineContext, query, true)
+}
 
-		if _, err := tx.Exec(
-			ctx,
-			sql,
-			args...,
-		); err != nil {
-			return err
-		}
+func (pg *PG) SuspendTask(ctx context.Context, task *stepper.Task, launchAt time.Time) error {
+	ms, err := json.Marshal(task.MiddlewaresState)
+	if err != nil {
+		return err
+	}
 
-		return nil
-	})
+	query := sq.
+		Update(pg.tasks).
+		Set("status", "suspended").
+		Set("launch_at", launchAt).
+		Set("attempt", sq.Expr("greatest(attempt - 1, 0)")).
+		Set("middlewares_state", string(ms)).
+		Where(sq.Eq{"id": task.ID})
+
+	return pg.execLeased(ctx, task.EngineContext, query, true)
 }
 
 func (pg *PG) CreateTask(ctx context.Context, task *stepper.Task) error {
@@ -193,20 +300,38 @@ func (pg *PG) CreateTask(ctx context.Context, task *stepper.Task) error {
 		return err
 	}
 
+	headers, err := json.Marshal(task.Headers)
+	if err != nil {
+		return err
+	}
+
+	var traceContext []byte
+	if task.TraceContext != nil {
+		if traceContext, err = json.Marshal(task.TraceContext); err != nil {
+			return err
+		}
+	}
+
 	if _, err := pg.pool.Exec(
 		ctx,
-		"INSERT INTO tasks VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)",
+		`INSERT INTO `+pg.tasks+` (id, custom_id, name, data, job_id, parent, launch_at, status, lock_at, state, middlewares_state, headers, job_run_id, tags, queue, trace_context)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)`,
 		task.ID,
 		task.CustomId,
 		task.Name,
-		string(task.Data),
+		task.Data,
 		task.JobId,
 		task.Parent,
-		task.LaunchAt.UnixNano(),
+		task.LaunchAt,
 		task.Status,
 		task.LockAt,
-		string(task.State),
+		task.State,
 		string(ms),
+		string(headers),
+		task.JobRunId,
+		task.Tags,
+		task.Queue,
+		traceContext,
 	); err != nil {
 		return err
 	}
@@ -228,8 +353,8 @@ func (pg *PG) GetUnreleasedTaskChildren(ctx context.Context, task *stepper.Task)
 		ctx,
 		tx,
 		&t,
-		"SELECT * FROM tasks WHERE parent = $2 AND status = ANY($1) ORDER BY id LIMIT 1",
-		[]string{"created", "in_progress"},
+		"SELECT * FROM "+pg.tasks+" WHERE parent = $2 AND (status = ANY($1) OR (status = 'failed' AND launch_at IS NOT NULL)) ORDER BY id LIMIT 1",
+		[]string{"created", "in_progress", "waiting", "suspended"},
 		task.ID,
 	); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -245,138 +370,239 @@ func (pg *PG) GetUnreleasedTaskChildren(ctx context.Context, task *stepper.Task)
 }
 
 func (pg *PG) SetState(ctx context.Context, task *stepper.Task, state []byte) error {
-	tx, err := pg.getTx(task.EngineContext)
+	query := sq.Update(pg.tasks).Set("state", state).Where(sq.Eq{"id": task.ID})
+
+	return pg.execLeased(ctx, task.EngineContext, query, false)
+}
+
+func (pg *PG) SetMiddlewaresState(ctx context.Context, task *stepper.Task) error {
+	ms, err := json.Marshal(task.MiddlewaresState)
 	if err != nil {
 		return err
 	}
 
-	if _, err := tx.Exec(ctx, "UPDATE tasks SET state = $1 WHERE id = $2", string(state), task.ID); err != nil {
+	query := sq.Update(pg.tasks).Set("middlewares_state", string(ms)).Where(sq.Eq{"id": task.ID})
+
+	return pg.execLeased(ctx, task.EngineContext, query, false)
+}
+
+func (pg *PG) CreateSignal(ctx context.Context, signal *stepper.Signal) error {
+	if _, err := pg.pool.Exec(
+		ctx,
+		"INSERT INTO "+pg.signals+" (id, target, name, payload, created_at) VALUES ($1, $2, $3, $4, $5)",
+		signal.ID,
+		signal.Target,
+		signal.Name,
+		signal.Payload,
+		signal.CreatedAt,
+	); err != nil {
+		return err
+	}
+
+	if _, err := pg.pool.Exec(
+		ctx,
+		"UPDATE "+pg.tasks+" SET launch_at = $2 WHERE status = 'suspended' AND (id = $1 OR custom_id = $1)",
+		signal.Target,
+		time.Now(),
+	); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (pg *PG) FindNextJob(ctx context.Context, statuses []string) (*stepper.Job, error) {
-	tx, err := pg.pool.BeginTx(ctx, pgx.TxOptions{})
-	if err != nil {
+func (pg *PG) WakeTask(ctx context.Context, id string) error {
+	_, err := pg.pool.Exec(ctx, "UPDATE "+pg.tasks+" SET launch_at = $2 WHERE id = $1 AND status = 'suspended'", id, time.Now())
+
+	return err
+}
+
+func (pg *PG) GetSignals(ctx context.Context, task *stepper.Task, name string) ([]*stepper.Signal, error) {
+	targets := []string{task.ID}
+	if task.CustomId != "" {
+		targets = append(targets, task.CustomId)
+	}
+
+	var signals []Signal
+
+	if err := pgxscan.Select(
+		ctx,
+		pg.pool,
+		&signals,
+		"SELECT * FROM "+pg.signals+" WHERE target = ANY($1) AND name = $2 ORDER BY created_at, id",
+		targets,
+		name,
+	); err != nil {
 		return nil, err
 	}
 
-	var task Job
+	result := make([]*stepper.Signal, 0, len(signals))
+	for i := range signals {
+		result = append(result, signals[i].ToModel())
+	}
+
+	return result, nil
+}
+
+// FindNextJob claims a job in a short transaction, the lease of the job is kept in Job.EngineContext.
+func (pg *PG) FindNextJob(ctx context.Context, statuses []string, filter stepper.ClaimFilter) (*stepper.Job, error) {
+	engineCtx, owner := pg.newLease(ctx)
+
+	var job Job
 
 	if err := pgxscan.Get(
 		ctx,
-		tx,
-		&task,
-		"SELECT * FROM jobs WHERE next_launch_at <= $2 AND status = ANY($1)  LIMIT 1 FOR UPDATE SKIP LOCKED",
+		pg.pool,
+		&job,
+		`UPDATE `+pg.jobs+` SET
+			status = CASE WHEN status = 'waiting' THEN status ELSE 'in_progress' END,
+			lock_at = $2,
+			locked_by = $6
+		WHERE name = (
+			SELECT name FROM `+pg.jobs+` WHERE next_launch_at <= $2 AND status = ANY($1) AND ($3::text[] IS NULL OR coalesce(tags, '{}') <@ $3)
+				AND ($4::text[] IS NULL OR name = ANY($4))
+				AND (lock_at IS NULL OR lock_at <= $5)
+			LIMIT 1 FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
 		statuses,
-		time.Now().UnixNano(),
+		time.Now(),
+		filter.Tags,
+		filter.Names,
+		pg.leaseExpiredAt(),
+		owner,
 	); err != nil {
-
 		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, tx.Commit(ctx)
+			return nil, nil
 		}
 
-		tx.Rollback(ctx)
-
-		return nil, fmt.Errorf("cannot find task: %w", err)
+		return nil, fmt.Errorf("cannot find job: %w", err)
 	}
 
-	res := &stepper.Job{
-		Name:         task.Name,
-		Pattern:      task.Pattern,
-		NextLaunchAt: time.Unix(0, task.NextLaunchAt),
-		Status:       task.Status,
-	}
+	res := job.ToModel()
 
-	res.EngineContext = context.WithValue(ctx, _ctxKey(ctxKey), tx)
+	res.EngineContext = engineCtx
 
 	return res, nil
 }
 
-func (pg *PG) GetUnreleasedJobChildren(ctx context.Context, jobName string) (*stepper.Task, error) {
-	var res *stepper.Task
-
+func (pg *PG) GetUnreleasedJobChildren(ctx context.Context, job *stepper.Job) (*stepper.Task, error) {
 	var t Task
 
-	tx, err := pg.pool.BeginTx(ctx, pgx.TxOptions{})
+	query := sq.Select("*").
+		From(pg.tasks).
+		Where(sq.Eq{"job_id": job.Name}).
+		Where(sq.Or{
+			sq.Eq{"status": []string{"created", "in_progress", "waiting", "suspended"}},
+			sq.And{sq.Eq{"status": "failed"}, sq.NotEq{"launch_at": nil}},
+		}).
+		OrderBy("id").
+		Limit(1).
+		PlaceholderFormat(sq.Dollar)
+
+	if job.RunId != "" {
+		query = query.Where(sq.Eq{"job_run_id": job.RunId})
+	}
+
+	sql, values, err := query.ToSql()
 	if err != nil {
 		return nil, err
 	}
 
-	if err := pgxscan.Get(
-		ctx,
-		tx,
-		&t,
-		"SELECT * FROM tasks WHERE job_id = $2 AND status = ANY($1) ORDER BY id LIMIT 1",
-		[]string{"created", "in_progress", "released"},
-		jobName,
-	); err != nil {
+	if err := pgxscan.Get(ctx, pg.pool, &t, sql, values...); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			defer tx.Commit(ctx)
-
-			//TODO hack for the locked transaction
-			return &stepper.Task{
-				Status: "in_progress",
-			}, nil
+			return nil, nil
 		}
-		tx.Rollback(ctx)
-		return nil, err
-	}
-
-	defer tx.Commit(ctx)
 
-	//TODO hack for the locked transaction
-	if t.Status == "released" {
-		return nil, nil
+		return nil, err
 	}
 
-	res = t.ToModel()
+	return t.ToModel(), nil
+}
 
-	return res, nil
+// keepPaused keeps the status of a job paused while it was claimed, the job is released by ResumeJob
+func keepPaused(status string) sq.Sqlizer {
+	return sq.Expr("CASE WHEN status = 'paused' THEN status ELSE ? END", status)
 }
 
 func (pg *PG) Release(ctx context.Context, job *stepper.Job, nextLaunchAt time.Time) error {
-	tx, err := pg.getTx(job.EngineContext)
-	if err != nil {
-		return err
-	}
-
-	if _, err := tx.Exec(ctx, "UPDATE jobs SET status = 'released', next_launch_at = $2 WHERE name = $1", job.Name, nextLaunchAt.UnixNano()); err != nil {
-		tx.Rollback(ctx)
-		return err
-	}
+	query := sq.
+		Update(pg.jobs).
+		Set("status", keepPaused("released")).
+		Set("next_launch_at", nextLaunchAt).
+		Set("launch_delay", int64(job.LaunchDelay)).
+		Where(sq.Eq{"name": job.Name})
+
+	return pg.execLeased(ctx, job.EngineContext, query, true)
+}
 
-	tx.Commit(ctx)
+func (pg *PG) RetireJob(ctx context.Context, job *stepper.Job) error {
+	query := sq.Update(pg.jobs).Set("status", "retired").Where(sq.Eq{"name": job.Name})
 
-	return nil
+	return pg.execLeased(ctx, job.EngineContext, query, true)
 }
 
 func (pg *PG) WaitForSubtasks(ctx context.Context, job *stepper.Job) error {
-	return pg.runTX(job.EngineContext, func(tx pgx.Tx) error {
-		_, err := tx.Exec(
-			ctx,
-			"UPDATE jobs SET status = 'waiting', next_launch_at = $1 WHERE name = $2",
-			time.Now().Add(time.Second*1).UnixNano(),
-			job.Name,
-		)
-
-		return err
-	})
+	query := sq.
+		Update(pg.jobs).
+		Set("status", keepPaused("waiting")).
+		Set("next_launch_at", time.Now().Add(time.Second*1)).
+		Set("scheduled_at", job.ScheduledAt).
+		Set("run_id", job.RunId).
+		Where(sq.Eq{"name": job.Name})
+
+	return pg.execLeased(ctx, job.EngineContext, query, true)
 }
 
 func (pg *PG) RegisterJob(ctx context.Context, cfg *stepper.JobConfig) error {
-	nextLaunchAt, err := cfg.NextLaunch()
+	nextLaunchAt, launchDelay, err := cfg.FirstLaunch()
 	if err != nil {
 		return err
 	}
 
 	// TODO may be trouble with locking
-	sql, values, err := sq.Insert("jobs").
-		Columns("name", "status", "next_launch_at", "pattern").
-		Values(cfg.Name, "created", nextLaunchAt.UnixNano(), cfg.Pattern).
-		Suffix("ON CONFLICT (name) DO UPDATE SET next_launch_at = ?, pattern = ?", 1, cfg.Pattern).
+	// the schedule of the existing job is kept, otherwise launches missed during a downtime will be lost
+	scheduleChanged := `(jobs.pattern IS DISTINCT FROM EXCLUDED.pattern
+		OR jobs.timezone IS DISTINCT FROM EXCLUDED.timezone
+		OR jobs.interval IS DISTINCT FROM EXCLUDED.interval
+		OR jobs.run_at IS DISTINCT FROM EXCLUDED.run_at)`
+
+	sql, values, err := sq.Insert(pg.jobs+" AS jobs").
+		Columns(
+			"name", "status", "next_launch_at", "launch_delay", "pattern", "interval", "run_at", "jitter",
+			"timezone", "misfire_policy", "overlap", "tags",
+		).
+		Values(
+			cfg.Name,
+			"created",
+			nextLaunchAt,
+			int64(launchDelay),
+			cfg.Pattern,
+			lo.Ternary(cfg.Interval == 0, nil, lo.ToPtr(int64(cfg.Interval))),
+			lo.Ternary(cfg.RunAt.IsZero(), nil, &cfg.RunAt),
+			cfg.Jitter,
+			cfg.Timezone,
+			string(cfg.MisfirePolicy),
+			string(cfg.Overlap),
+			cfg.Tags,
+		).
+		Suffix(`ON CONFLICT (name) DO UPDATE SET
+			next_launch_at = CASE WHEN ` + scheduleChanged + ` THEN EXCLUDED.next_launch_at ELSE jobs.next_launch_at END,
+			launch_delay = CASE WHEN ` + scheduleChanged + ` THEN EXCLUDED.launch_delay ELSE jobs.launch_delay END,
+			status = CASE
+				WHEN jobs.status = 'orphaned' THEN 'released'
+				WHEN jobs.status = 'retired' AND ` + scheduleChanged + ` THEN 'released'
+				ELSE jobs.status
+			END,
+			orphaned_at = NULL,
+			pattern = EXCLUDED.pattern,
+			interval = EXCLUDED.interval,
+			run_at = EXCLUDED.run_at,
+			jitter = EXCLUDED.jitter,
+			timezone = EXCLUDED.timezone,
+			misfire_policy = EXCLUDED.misfire_policy,
+			overlap = EXCLUDED.overlap,
+			tags = EXCLUDED.tags`).
 		PlaceholderFormat(sq.Dollar).
 		ToSql()
 	if err != nil {
@@ -390,25 +616,212 @@ func (pg *PG) RegisterJob(ctx context.Context, cfg *stepper.JobConfig) error {
 	return nil
 }
 
-func (pg *PG) getTx(ctx context.Context) (pgx.Tx, error) {
-	tx, ok := ctx.Value(_ctxKey(ctxKey)).(pgx.Tx)
-	if !ok {
-		return nil, fmt.Errorf("cannot get pg context")
+func (pg *PG) GetJob(ctx context.Context, name string) (*stepper.Job, error) {
+	var job Job
+
+	if err := pgxscan.Get(ctx, pg.pool, &job, "SELECT * FROM "+pg.jobs+" WHERE name = $1", name); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+
+		return nil, err
 	}
 
-	return tx, nil
+	return job.ToModel(), nil
+}
+
+func (pg *PG) PauseJob(ctx context.Context, name string) error {
+	_, err := pg.pool.Exec(ctx, "UPDATE "+pg.jobs+" SET status = 'paused' WHERE name = $1", name)
+
+	return err
+}
+
+func (pg *PG) ResumeJob(ctx context.Context, job *stepper.Job) error {
+	_, err := pg.pool.Exec(
+		ctx,
+		"UPDATE "+pg.jobs+" SET status = $2, next_launch_at = $3, launch_delay = $4, lock_at = NULL, locked_by = NULL WHERE name = $1 AND status = 'paused'",
+		job.Name,
+		job.Status,
+		job.NextLaunchAt,
+		int64(job.LaunchDelay),
+	)
+
+	return err
+}
+
+func (pg *PG) TriggerJob(ctx context.Context, name string) error {
+	_, err := pg.pool.Exec(
+		ctx,
+		"UPDATE "+pg.jobs+" SET next_launch_at = $2, launch_delay = 0 WHERE name = $1 AND status IN ('created', 'released')",
+		name,
+		time.Now(),
+	)
+
+	return err
 }
 
-func (pg *PG) runTX(ctx context.Context, callback func(tx pgx.Tx) error) error {
-	tx, err := pg.getTx(ctx)
+func (pg *PG) DeleteJob(ctx context.Context, name string) error {
+	_, err := pg.pool.Exec(ctx, "DELETE FROM "+pg.jobs+" WHERE name = $1", name)
+
+	return err
+}
+
+func (pg *PG) UpdateJobPattern(ctx context.Context, name string, pattern string, nextLaunchAt time.Time) error {
+	// a running job uses next_launch_at to check its subtasks, the launch will be calculated after the release
+	_, err := pg.pool.Exec(
+		ctx,
+		`UPDATE `+pg.jobs+` SET
+			pattern = $2,
+			interval = NULL,
+			run_at = NULL,
+			next_launch_at = CASE WHEN status IN ('waiting', 'in_progress') THEN next_launch_at ELSE $3 END,
+			launch_delay = CASE WHEN status IN ('waiting', 'in_progress') THEN launch_delay ELSE 0 END
+		WHERE name = $1`,
+		name,
+		pattern,
+		nextLaunchAt,
+	)
+
+	return err
+}
+
+func (pg *PG) GetJobs(ctx context.Context) ([]*stepper.Job, error) {
+	var jobs []Job
+
+	if err := pgxscan.Select(ctx, pg.pool, &jobs, "SELECT * FROM "+pg.jobs); err != nil {
+		return nil, err
+	}
+
+	result := make([]*stepper.Job, 0, len(jobs))
+	for i := range jobs {
+		result = append(result, jobs[i].ToModel())
+	}
+
+	return result, nil
+}
+
+func (pg *PG) MarkJobOrphaned(ctx context.Context, name string) error {
+	_, err := pg.pool.Exec(
+		ctx,
+		"UPDATE "+pg.jobs+" SET status = 'orphaned', orphaned_at = $2 WHERE name = $1 AND status IN ('created', 'released')",
+		name,
+		time.Now(),
+	)
+
+	return err
+}
+
+func (pg *PG) SaveNode(ctx context.Context, node *stepper.Node) error {
+	_, err := pg.pool.Exec(
+		ctx,
+		`INSERT INTO `+pg.nodes+` (id, jobs, tasks, queues, tags, seen_at) VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (id) DO UPDATE SET jobs = EXCLUDED.jobs, tasks = EXCLUDED.tasks, queues = EXCLUDED.queues,
+			tags = EXCLUDED.tags, seen_at = EXCLUDED.seen_at`,
+		node.ID,
+		node.Jobs,
+		node.Tasks,
+		node.Queues,
+		node.Tags,
+		node.SeenAt,
+	)
+
+	return err
+}
+
+func (pg *PG) GetNodes(ctx context.Context, seenAfter time.Time) ([]*stepper.Node, error) {
+	var nodes []Node
+
+	if err := pgxscan.Select(ctx, pg.pool, &nodes, "SELECT * FROM "+pg.nodes+" WHERE seen_at >= $1", seenAfter); err != nil {
+		return nil, err
+	}
+
+	result := make([]*stepper.Node, 0, len(nodes))
+	for i := range nodes {
+		result = append(result, nodes[i].ToModel())
+	}
+
+	return result, nil
+}
+
+func (pg *PG) DeleteNodes(ctx context.Context, seenBefore time.Time) error {
+	_, err := pg.pool.Exec(ctx, "DELETE FROM "+pg.nodes+" WHERE seen_at < $1", seenBefore)
+
+	return err
+}
+
+func (pg *PG) SaveJobRun(ctx context.Context, run *stepper.JobRun) error {
+	var startedAt, finishedAt *time.Time
+	if !run.StartedAt.IsZero() {
+		startedAt = &run.StartedAt
+	}
+
+	if !run.FinishedAt.IsZero() {
+		finishedAt = &run.FinishedAt
+	}
+
+	sql, values, err := sq.Insert(pg.jobRuns).
+		Columns("id", "job", "task_id", "number", "status", "previous_status", "scheduled_at", "started_at", "finished_at").
+		Values(
+			run.ID,
+			run.Job,
+			run.TaskId,
+			run.Number,
+			run.Status,
+			run.PreviousStatus,
+			run.ScheduledAt,
+			startedAt,
+			finishedAt,
+		).
+		Suffix("ON CONFLICT (id) DO UPDATE SET status = EXCLUDED.status, started_at = EXCLUDED.started_at, finished_at = EXCLUDED.finished_at").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
 	if err != nil {
 		return err
 	}
 
-	if err := callback(tx); err != nil {
-		tx.Rollback(ctx)
-		return err
+	_, err = pg.pool.Exec(ctx, sql, values...)
+
+	return err
+}
+
+func (pg *PG) DeleteJobRuns(ctx context.Context, name string, number int) error {
+	_, err := pg.pool.Exec(ctx, "DELETE FROM "+pg.jobRuns+" WHERE job = $1 AND number < $2", name, number)
+
+	return err
+}
+
+func (pg *PG) GetJobRun(ctx context.Context, id string) (*stepper.JobRun, error) {
+	var run JobRun
+
+	if err := pgxscan.Get(ctx, pg.pool, &run, "SELECT * FROM "+pg.jobRuns+" WHERE id = $1", id); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return run.ToModel(), nil
+}
+
+func (pg *PG) GetJobRuns(ctx context.Context, name string, limit int) ([]*stepper.JobRun, error) {
+	var runs []JobRun
+
+	if err := pgxscan.Select(
+		ctx,
+		pg.pool,
+		&runs,
+		"SELECT * FROM "+pg.jobRuns+" WHERE job = $1 ORDER BY number DESC LIMIT $2",
+		name,
+		lo.Ternary(limit > 0, &limit, nil),
+	); err != nil {
+		return nil, err
+	}
+
+	result := make([]*stepper.JobRun, 0, len(runs))
+	for i := range runs {
+		result = append(result, runs[i].ToModel())
 	}
 
-	return tx.Commit(ctx)
+	return result, nil
 }
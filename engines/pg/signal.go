@@ -0,0 +1,25 @@
+package pg
+
+import (
+	"time"
+
+	"github.com/matroskin13/stepper"
+)
+
+type Signal struct {
+	ID        string    `json:"id"`
+	Target    string    `json:"target"`
+	Name      string    `json:"name"`
+	Payload   []byte    `json:"payload"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (s *Signal) ToModel() *stepper.Signal {
+	return &stepper.Signal{
+		ID:        s.ID,
+		Target:    s.Target,
+		Name:      s.Name,
+		Payload:   s.Payload,
+		CreatedAt: s.CreatedAt,
+	}
+}
@@ -6,41 +6,60 @@ import (
 	"time"
 
 	"github.com/matroskin13/stepper"
+	"github.com/samber/lo"
 )
 
 type Task struct {
 	ID               string     `json:"_id"`
 	CustomId         string     `bson:"custom_id"`
 	Name             string     `json:"name"`
-	Data             string     `json:"data"`
+	Data             []byte     `json:"data"`
 	JobId            string     `json:"jobId"`
+	JobRunId         *string    `json:"jobRunId"`
 	Parent           string     `json:"parent"`
-	LaunchAt         int64      `json:"launchAt"`
+	LaunchAt         *time.Time `json:"launchAt"`
 	Status           string     `json:"status"`
 	LockAt           *time.Time `json:"lock_at"`
-	State            string     `json:"state"`
-	MiddlewaresState string     `json:"middlewares_state"`
+	LockedBy         *string    `json:"locked_by"`
+	State            []byte     `json:"state"`
+	MiddlewaresState []byte     `json:"middlewares_state"`
 	Error            *string
+	Headers          *string         `json:"headers"`
+	Tags             []string        `json:"tags"`
+	Queue            *string         `json:"queue"`
+	Attempt          int             `json:"attempt"`
+	TraceContext     []byte          `json:"trace_context"`
 	EngineContext    context.Context `json:"-"`
 }
 
 func (t *Task) ToModel() *stepper.Task {
-
 	tm := stepper.Task{
 		ID:               t.ID,
 		CustomId:         t.CustomId,
 		Name:             t.Name,
-		Data:             []byte(t.Data),
+		Data:             t.Data,
 		JobId:            t.JobId,
+		JobRunId:         lo.FromPtr(t.JobRunId),
 		Parent:           t.Parent,
-		LaunchAt:         time.Unix(0, t.LaunchAt),
+		LaunchAt:         lo.FromPtr(t.LaunchAt),
 		Status:           t.Status,
 		LockAt:           t.LockAt,
-		State:            []byte(t.State),
+		State:            t.State,
 		MiddlewaresState: map[string][]byte{},
+		Tags:             t.Tags,
+		Queue:            lo.FromPtr(t.Queue),
+		Attempt:          t.Attempt,
 	}
 
-	json.Unmarshal([]byte(t.MiddlewaresState), &tm.MiddlewaresState)
+	json.Unmarshal(t.MiddlewaresState, &tm.MiddlewaresState)
+
+	if t.TraceContext != nil {
+		json.Unmarshal(t.TraceContext, &tm.TraceContext)
+	}
+
+	if t.Headers != nil {
+		json.Unmarshal([]byte(*t.Headers), &tm.Headers)
+	}
 
 	return &tm
 }
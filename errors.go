@@ -0,0 +1,66 @@
+package stepper
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks an error which must not be retried, the task is failed forever.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &permanentError{err: err}
+}
+
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
+
+type retryAfterError struct {
+	err   error
+	delay time.Duration
+}
+
+func (e *retryAfterError) Error() string {
+	return fmt.Sprintf("%s (retry after %s)", e.err, e.delay)
+}
+
+func (e *retryAfterError) Unwrap() error {
+	return e.err
+}
+
+// RetryAfter sets a delay before the next attempt of the task,
+// e.g. from the Retry-After header of a response.
+func RetryAfter(err error, delay time.Duration) error {
+	if err == nil {
+		return nil
+	}
+
+	return &retryAfterError{err: err, delay: delay}
+}
+
+// RetryDelay returns a delay which is set by RetryAfter.
+func RetryDelay(err error) (time.Duration, bool) {
+	var retryAfter *retryAfterError
+	if errors.As(err, &retryAfter) {
+		return retryAfter.delay, true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,73 @@
+package stepper
+
+import (
+	"context"
+	"time"
+)
+
+type EventType string
+
+const (
+	EventPublished EventType = "published"
+	EventClaimed   EventType = "claimed"
+	EventSucceeded EventType = "succeeded"
+	// EventFailed is fired when a task is failed and will be retried at Event.RetryAt
+	EventFailed EventType = "failed"
+	// EventDead is fired when a task is failed and will never be launched again
+	EventDead            EventType = "dead"
+	EventSubtasksCreated EventType = "subtasks_created"
+	// EventParentFinished is fired when all subtasks of a task are finished and the task is released
+	EventParentFinished EventType = "parent_finished"
+	EventJobFired       EventType = "job_fired"
+	EventJobReleased    EventType = "job_released"
+)
+
+type Event struct {
+	Type EventType
+	Time time.Time
+	// Task is nil for events of jobs
+	Task *Task
+	// Job is set for events of jobs
+	Job *Job
+	// Err is the error of a failed or dead task
+	Err     error
+	RetryAt time.Time
+	// Subtasks is the count of created subtasks
+	Subtasks int
+}
+
+// EventListener is called synchronously, so it must not block. A panic of the listener is recovered and logged.
+type EventListener func(ctx context.Context, event Event)
+
+// OnEvent adds a listener of lifecycle events of tasks and jobs.
+func (s *Service) OnEvent(listener EventListener) {
+	s.listenersMu.Lock()
+	defer s.listenersMu.Unlock()
+
+	s.listeners = append(s.listeners, listener)
+}
+
+func (s *Service) emit(ctx context.Context, event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	s.listenersMu.RLock()
+	listeners := s.listeners
+	s.listenersMu.RUnlock()
+
+	for _, listener := range listeners {
+		s.callListener(ctx, listener, event)
+	}
+}
+
+// callListener recovers a panic of the listener, so it does not break the handling of a task or a job
+func (s *Service) callListener(ctx context.Context, listener EventListener, event Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.logger.Error("event listener panicked", "event", event.Type, "panic", r)
+		}
+	}()
+
+	listener(ctx, event)
+}
@@ -2,45 +2,314 @@ package stepper
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"math/rand"
 	"time"
 
 	"github.com/robfig/cron/v3"
+	"github.com/samber/lo"
+)
+
+var cronParser = cron.NewParser(
+	cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor,
+)
+
+var ErrJobNotFound = errors.New("job not found")
+
+type MisfirePolicy string
+
+const (
+	// MisfireRunOnce runs a job once for all missed launches, the run is scheduled at the latest of them
+	MisfireRunOnce MisfirePolicy = "run_once"
+	// MisfireSkip skips all missed launches and waits for the next one by the schedule
+	MisfireSkip MisfirePolicy = "skip"
+	// MisfireRunAll runs a job for every missed launch one by one
+	MisfireRunAll MisfirePolicy = "run_all"
+)
+
+type OverlapPolicy string
+
+const (
+	// OverlapForbid skips launches which come while the previous run is in progress
+	OverlapForbid OverlapPolicy = "forbid"
+	// OverlapAllow launches a new run even if the previous one is in progress
+	OverlapAllow OverlapPolicy = "allow"
+	// OverlapQueue postpones launches which come while the previous run is in progress until the end of the run
+	OverlapQueue OverlapPolicy = "queue"
 )
 
 type Job struct {
 	Status        string          `json:"status"`
 	Name          string          `json:"name"`
+	Tags          []string        `json:"tags"`
 	Pattern       string          `json:"pattern"`
+	Interval      time.Duration   `json:"interval"`
+	RunAt         time.Time       `json:"runAt"`
+	Jitter        float64         `json:"jitter"`
+	Timezone      string          `json:"timezone"`
+	MisfirePolicy MisfirePolicy   `json:"misfirePolicy"`
+	Overlap       OverlapPolicy   `json:"overlap"`
 	NextLaunchAt  time.Time       `json:"naxtLaunchAt"`
+	LaunchDelay   time.Duration   `json:"launchDelay"`
+	ScheduledAt   time.Time       `json:"scheduledAt"`
+	RunId         string          `json:"runId"`
+	OrphanedAt    time.Time       `json:"orphanedAt"`
 	EngineContext context.Context `json:"-"`
 }
 
 func (j *Job) CalculateNextLaunch() error {
-	specParser := cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+	return j.calculateNextLaunch(j.ScheduledAt)
+}
+
+// ScheduledLaunch returns the launch by the schedule without the jitter.
+func (j *Job) ScheduledLaunch() time.Time {
+	return j.NextLaunchAt.Add(-j.LaunchDelay)
+}
+
+// IsRetired reports whether the job has no more launches, e.g. a job with RunAt has been launched.
+func (j *Job) IsRetired() bool {
+	return j.NextLaunchAt.IsZero()
+}
+
+func (j *Job) schedule() (cron.Schedule, error) {
+	return parseSchedule(j.Pattern, j.Interval, j.RunAt, j.Timezone)
+}
+
+// calculateNextLaunch calculates the launch after the run which was scheduled at ScheduledAt
+// and actually started at startedAt. Launches missed before the start are handled by MisfirePolicy,
+// launches missed during the run are handled by Overlap.
+func (j *Job) calculateNextLaunch(startedAt time.Time) error {
+	now := time.Now()
 
-	schedule, err := specParser.Parse(j.Pattern)
+	schedule, err := j.schedule()
 	if err != nil {
 		return err
 	}
 
-	j.NextLaunchAt = schedule.Next(time.Now())
+	next := schedule.Next(now)
+
+	if !j.ScheduledAt.IsZero() {
+		candidate := schedule.Next(j.ScheduledAt)
+
+		switch {
+		case candidate.After(now), j.MisfirePolicy == MisfireRunAll:
+			next = candidate
+		case j.Overlap == OverlapQueue && startedAt.After(j.ScheduledAt):
+			next = schedule.Next(startedAt)
+		case j.Overlap == OverlapQueue:
+			next = candidate
+		}
+	}
+
+	// a launch which is already late is not moved earlier
+	j.LaunchDelay = jitterDelay(schedule, next, j.Jitter, lo.Ternary(next.Before(now), next, now))
+	j.NextLaunchAt = lo.Ternary(next.IsZero(), next, next.Add(j.LaunchDelay))
 
 	return nil
 }
 
+// runScheduledAt returns the launch the run is for. Missed launches which are caught up by a single run
+// are represented by the latest of them.
+func (j *Job) runScheduledAt(now time.Time) time.Time {
+	scheduled := j.ScheduledLaunch()
+
+	if j.MisfirePolicy == MisfireRunAll {
+		return scheduled
+	}
+
+	schedule, err := j.schedule()
+	if err != nil {
+		return scheduled
+	}
+
+	for next := schedule.Next(scheduled); !next.IsZero() && !next.After(now); next = schedule.Next(next) {
+		scheduled = next
+	}
+
+	return scheduled
+}
+
+// IsMisfired reports whether the job has missed more than one launch by the schedule.
+func (j *Job) IsMisfired() bool {
+	schedule, err := j.schedule()
+	if err != nil {
+		return false
+	}
+
+	next := schedule.Next(j.ScheduledLaunch())
+
+	return !next.IsZero() && !next.After(time.Now())
+}
+
 type JobConfig struct {
+	// Tags restrict nodes which can launch the job, see WithNodeTags
 	Tags    []string
 	Name    string
 	Pattern string
+	// Interval launches the job every Interval instead of Pattern
+	Interval time.Duration
+	// RunAt launches the job once at the time instead of Pattern, the job is retired after the launch
+	RunAt time.Time
+	// Jitter moves every launch randomly earlier or later by up to the part of the period between launches (0.1 is ±10%)
+	Jitter float64
+	// Timezone is an IANA name of a location (Europe/Berlin), the local time of the server is used by default
+	Timezone      string
+	MisfirePolicy MisfirePolicy
+	Overlap       OverlapPolicy
+	// Headers are set to every task of the job and inherited by its subtasks
+	Headers map[string]string
+	// KeepRuns is the count of the latest runs kept in the history, DefaultKeepRuns is used by default
+	KeepRuns int
 }
 
 func (c *JobConfig) NextLaunch() (time.Time, error) {
-	specParser := cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+	// a one-off job is launched even if the time has passed
+	if !c.RunAt.IsZero() {
+		return c.RunAt, nil
+	}
 
-	schedule, err := specParser.Parse(c.Pattern)
+	schedule, err := parseSchedule(c.Pattern, c.Interval, c.RunAt, c.Timezone)
 	if err != nil {
 		return time.Now(), err
 	}
 
 	return schedule.Next(time.Now()), nil
 }
+
+// FirstLaunch returns the first launch moved by Jitter and the shift of the launch,
+// so jobs registered together are not launched at once.
+func (c *JobConfig) FirstLaunch() (time.Time, time.Duration, error) {
+	next, err := c.NextLaunch()
+	if err != nil || !c.RunAt.IsZero() {
+		return next, 0, err
+	}
+
+	schedule, err := parseSchedule(c.Pattern, c.Interval, c.RunAt, c.Timezone)
+	if err != nil {
+		return next, 0, err
+	}
+
+	delay := jitterDelay(schedule, next, c.Jitter, time.Now())
+
+	return next.Add(delay), delay, nil
+}
+
+func (c *JobConfig) Validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("name of job is empty")
+	}
+
+	if len(lo.Compact([]bool{c.Pattern != "", c.Interval != 0, !c.RunAt.IsZero()})) != 1 {
+		return fmt.Errorf("invalid job=%s: exactly one of pattern, interval or run at must be set", c.Name)
+	}
+
+	if c.Interval < 0 {
+		return fmt.Errorf("invalid job=%s: negative interval=%s", c.Name, c.Interval)
+	}
+
+	if c.KeepRuns < 0 {
+		return fmt.Errorf("invalid job=%s: negative keep runs=%d", c.Name, c.KeepRuns)
+	}
+
+	if c.Jitter < 0 || c.Jitter >= 1 {
+		return fmt.Errorf("invalid job=%s: jitter=%v must be in [0, 1)", c.Name, c.Jitter)
+	}
+
+	if _, err := parseSchedule(c.Pattern, c.Interval, c.RunAt, c.Timezone); err != nil {
+		return fmt.Errorf("invalid job=%s: %w", c.Name, err)
+	}
+
+	switch c.MisfirePolicy {
+	case "", MisfireRunOnce, MisfireSkip, MisfireRunAll:
+	default:
+		return fmt.Errorf("invalid job=%s: unknown misfire policy=%s", c.Name, c.MisfirePolicy)
+	}
+
+	switch c.Overlap {
+	case "", OverlapForbid, OverlapAllow, OverlapQueue:
+	default:
+		return fmt.Errorf("invalid job=%s: unknown overlap policy=%s", c.Name, c.Overlap)
+	}
+
+	return nil
+}
+
+type intervalSchedule time.Duration
+
+func (s intervalSchedule) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(s))
+}
+
+type onceSchedule time.Time
+
+func (s onceSchedule) Next(t time.Time) time.Time {
+	if t.Before(time.Time(s)) {
+		return time.Time(s)
+	}
+
+	return time.Time{}
+}
+
+type locationSchedule struct {
+	schedule cron.Schedule
+	location *time.Location
+}
+
+func (s locationSchedule) Next(t time.Time) time.Time {
+	return s.schedule.Next(t.In(s.location))
+}
+
+func parseSchedule(pattern string, interval time.Duration, runAt time.Time, timezone string) (cron.Schedule, error) {
+	location, err := loadLocation(timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case !runAt.IsZero():
+		return onceSchedule(runAt), nil
+	case interval > 0:
+		return intervalSchedule(interval), nil
+	}
+
+	schedule, err := cronParser.Parse(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse pattern=%s: %w", pattern, err)
+	}
+
+	return locationSchedule{schedule: schedule, location: location}, nil
+}
+
+// jitterDelay returns a random shift of the launch at the time in both directions, the shift is limited
+// by the part of the period until the following launch, and the launch is never moved before notBefore.
+func jitterDelay(schedule cron.Schedule, at time.Time, jitter float64, notBefore time.Time) time.Duration {
+	if jitter <= 0 || at.IsZero() {
+		return 0
+	}
+
+	following := schedule.Next(at)
+	if following.IsZero() {
+		return 0
+	}
+
+	delay := time.Duration((rand.Float64()*2 - 1) * jitter * float64(following.Sub(at)))
+	if at.Add(delay).Before(notBefore) {
+		return notBefore.Sub(at)
+	}
+
+	return delay
+}
+
+func loadLocation(timezone string) (*time.Location, error) {
+	if timezone == "" {
+		return time.Local, nil
+	}
+
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load timezone=%s: %w", timezone, err)
+	}
+
+	return location, nil
+}
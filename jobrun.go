@@ -0,0 +1,166 @@
+package stepper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/rs/xid"
+)
+
+const (
+	JobRunRunning   = "running"
+	JobRunSucceeded = "succeeded"
+	JobRunFailed    = "failed"
+)
+
+// DefaultKeepRuns is the count of the latest runs of a job kept in the history by default
+const DefaultKeepRuns = 100
+
+// JobRun describes a launch of a job, the scheduled time is the time the run was for.
+type JobRun struct {
+	ID             string    `json:"id"`
+	Job            string    `json:"job"`
+	TaskId         string    `json:"taskId"`
+	Number         int       `json:"number"`
+	Status         string    `json:"status"`
+	PreviousStatus string    `json:"previousStatus"`
+	ScheduledAt    time.Time `json:"scheduledAt"`
+	// StartedAt is the time the handler of the run was started, it is zero until the handler is started
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+}
+
+// GetJobRuns returns the history of a job, the latest runs go first.
+func (s *Service) GetJobRuns(ctx context.Context, name string, limit int) ([]*JobRun, error) {
+	return s.jobEngine.GetJobRuns(ctx, name, limit)
+}
+
+func (s *Service) startJobRun(ctx context.Context, job *Job) (*JobRun, error) {
+	run := &JobRun{
+		ID:          xid.New().String(),
+		Job:         job.Name,
+		TaskId:      xid.New().String(),
+		Number:      1,
+		Status:      JobRunRunning,
+		ScheduledAt: job.ScheduledAt,
+	}
+
+	previous, err := s.jobEngine.GetJobRuns(ctx, job.Name, 1)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get previous run of job=%s: %w", job.Name, err)
+	}
+
+	if len(previous) > 0 {
+		run.Number = previous[0].Number + 1
+		run.PreviousStatus = previous[0].Status
+	}
+
+	if err := s.jobEngine.SaveJobRun(ctx, run); err != nil {
+		return nil, fmt.Errorf("cannot save run of job=%s: %w", job.Name, err)
+	}
+
+	keep := DefaultKeepRuns
+	if jobHs, ok := s.jobs[job.Name]; ok && jobHs.jobConfig.KeepRuns > 0 {
+		keep = jobHs.jobConfig.KeepRuns
+	}
+
+	if run.Number > keep {
+		if err := s.jobEngine.DeleteJobRuns(ctx, job.Name, run.Number-keep+1); err != nil {
+			return nil, fmt.Errorf("cannot delete old runs of job=%s: %w", job.Name, err)
+		}
+	}
+
+	return run, nil
+}
+
+// markJobRunStarted records the time the handler of the run is started for the first time,
+// the data of the task is updated, so the handler gets the actual run.
+func (s *Service) markJobRunStarted(ctx context.Context, task *Task) error {
+	if task.JobRunId == "" {
+		return nil
+	}
+
+	run, err := s.jobEngine.GetJobRun(ctx, task.JobRunId)
+	if err != nil || run == nil {
+		return err
+	}
+
+	if run.StartedAt.IsZero() {
+		run.StartedAt = time.Now()
+
+		if err := s.jobEngine.SaveJobRun(ctx, run); err != nil {
+			return err
+		}
+	}
+
+	data, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+
+	task.Data = data
+
+	return nil
+}
+
+func (s *Service) finishJobRun(ctx context.Context, id string) (*JobRun, error) {
+	if id == "" {
+		return nil, nil
+	}
+
+	run, err := s.jobEngine.GetJobRun(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if run == nil || run.Status != JobRunRunning {
+		return run, nil
+	}
+
+	task, err := s.mongo.GetTask(ctx, run.TaskId)
+	if err != nil {
+		return nil, err
+	}
+
+	run.Status = JobRunSucceeded
+	run.FinishedAt = time.Now()
+
+	if task != nil && task.IsDead() {
+		run.Status = JobRunFailed
+	}
+
+	return run, s.jobEngine.SaveJobRun(ctx, run)
+}
+
+// finishConcurrentJobRun is called when a task of a job is over. Runs of jobs which allow overlapping
+// are finished by their tasks, because the job itself is released right after the launch.
+func (s *Service) finishConcurrentJobRun(ctx context.Context, task *Task) error {
+	jobHs, ok := s.jobs[task.JobId]
+	if !ok || jobHs.jobConfig.Overlap != OverlapAllow {
+		return nil
+	}
+
+	if jobHs.onFinish != nil {
+		if err := jobHs.onFinish(&taskContext{ctx: ctx, task: task, taskEngine: s.mongo}, nil); err != nil {
+			return err
+		}
+	}
+
+	_, err := s.finishJobRun(ctx, task.JobRunId)
+
+	return err
+}
+
+func (c *taskContext) JobRun() *JobRun {
+	if c.task.JobId == "" {
+		return nil
+	}
+
+	var run JobRun
+
+	json.Unmarshal(c.task.Data, &run)
+
+	return &run
+}
@@ -0,0 +1,61 @@
+package stepper
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// Logger is a structured levelled logger, args are key-value pairs. *slog.Logger implements the interface.
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+// WithLogger sets the logger of the service, by default warnings and errors are written to stderr.
+func WithLogger(logger Logger) ServiceOption {
+	return func(s *Service) {
+		s.logger = logger
+	}
+}
+
+// stdLogger writes warnings and errors by the standard logger
+type stdLogger struct {
+	logger *log.Logger
+}
+
+func newStdLogger() *stdLogger {
+	return &stdLogger{logger: log.New(os.Stderr, "stepper: ", log.LstdFlags)}
+}
+
+func (l *stdLogger) Debug(msg string, args ...any) {}
+
+func (l *stdLogger) Info(msg string, args ...any) {}
+
+func (l *stdLogger) Warn(msg string, args ...any) {
+	l.print("WARN", msg, args)
+}
+
+func (l *stdLogger) Error(msg string, args ...any) {
+	l.print("ERROR", msg, args)
+}
+
+func (l *stdLogger) print(level string, msg string, args []any) {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%s %s", level, msg)
+
+	for i := 0; i+1 < len(args); i += 2 {
+		fmt.Fprintf(&b, " %v=%v", args[i], args[i+1])
+	}
+
+	l.logger.Print(b.String())
+}
+
+// taskAttrs returns attributes of the task for logs
+func taskAttrs(task *Task, args ...any) []any {
+	return append([]any{"task_id", task.ID, "task", task.Name, "attempt", task.Attempt}, args...)
+}
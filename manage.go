@@ -0,0 +1,113 @@
+package stepper
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+func (s *Service) PauseJob(ctx context.Context, name string) error {
+	job, err := s.getJob(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	if job.Status == "retired" {
+		return fmt.Errorf("cannot pause retired job=%s", name)
+	}
+
+	return s.jobEngine.PauseJob(ctx, name)
+}
+
+func (s *Service) ResumeJob(ctx context.Context, name string) error {
+	job, err := s.getJob(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	if job.Status != "paused" {
+		return nil
+	}
+
+	var run *JobRun
+
+	if job.RunId != "" {
+		if run, err = s.jobEngine.GetJobRun(ctx, job.RunId); err != nil {
+			return err
+		}
+	}
+
+	// an unfinished run will be finished by ListenWaitingJobs, the next launch is calculated after that
+	if run != nil && run.Status == JobRunRunning {
+		job.Status = "waiting"
+		job.NextLaunchAt = time.Now()
+
+		return s.jobEngine.ResumeJob(ctx, job)
+	}
+
+	schedule, err := job.schedule()
+	if err != nil {
+		return err
+	}
+
+	// a one-off job which has missed its time during the pause is launched immediately
+	next := schedule.Next(time.Now())
+	if next.IsZero() {
+		next = time.Now()
+	}
+
+	job.Status = "released"
+	job.NextLaunchAt = next
+	job.LaunchDelay = 0
+
+	return s.jobEngine.ResumeJob(ctx, job)
+}
+
+// TriggerJob launches a job immediately, the schedule continues from the moment of the launch.
+func (s *Service) TriggerJob(ctx context.Context, name string) error {
+	job, err := s.getJob(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	if job.Status != "created" && job.Status != "released" {
+		return fmt.Errorf("cannot trigger job=%s with status=%s", name, job.Status)
+	}
+
+	return s.jobEngine.TriggerJob(ctx, name)
+}
+
+func (s *Service) DeleteJob(ctx context.Context, name string) error {
+	return s.jobEngine.DeleteJob(ctx, name)
+}
+
+// UpdateJobPattern changes a pattern of the job until the next start of a service,
+// RegisterJob will set the pattern from JobConfig again. An interval or one-off job becomes a cron job.
+func (s *Service) UpdateJobPattern(ctx context.Context, name string, pattern string) error {
+	job, err := s.getJob(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	schedule, err := parseSchedule(pattern, 0, time.Time{}, job.Timezone)
+	if err != nil {
+		return err
+	}
+
+	next := schedule.Next(time.Now())
+
+	return s.jobEngine.UpdateJobPattern(ctx, name, pattern, next)
+}
+
+func (s *Service) getJob(ctx context.Context, name string) (*Job, error) {
+	job, err := s.jobEngine.GetJob(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if job == nil {
+		return nil, fmt.Errorf("%w: %s", ErrJobNotFound, name)
+	}
+
+	return job, nil
+}
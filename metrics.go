@@ -0,0 +1,153 @@
+package stepper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// TaskStats is a count of tasks with the same name and status
+type TaskStats struct {
+	Name string
+	// Status is "dead" for failed tasks which will never be launched again
+	Status string
+	Count  int64
+	// OldestDueAt is the earliest launch time of due tasks in the group, it is zero if the group has no due tasks
+	OldestDueAt time.Time
+}
+
+type metrics struct {
+	tasks       *prometheus.GaugeVec
+	queueLag    *prometheus.GaugeVec
+	waiting     prometheus.Gauge
+	dead        *prometheus.GaugeVec
+	jobLateness *prometheus.GaugeVec
+	unhandled   *prometheus.GaugeVec
+}
+
+// newMetrics registers metrics in the registerer, metrics registered by another service are reused
+func newMetrics(registerer prometheus.Registerer) *metrics {
+	return &metrics{
+		tasks: register(registerer, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "stepper_tasks",
+			Help: "Count of tasks by name and status",
+		}, []string{"task", "status"})),
+		queueLag: register(registerer, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "stepper_queue_lag_seconds",
+			Help: "Age of the oldest due task",
+		}, []string{"task"})),
+		waiting: register(registerer, prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "stepper_waiting_parents",
+			Help: "Count of tasks which wait for their subtasks",
+		})),
+		dead: register(registerer, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "stepper_dead_tasks",
+			Help: "Count of tasks which will never be launched again",
+		}, []string{"task"})),
+		jobLateness: register(registerer, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "stepper_job_lateness_seconds",
+			Help: "Time since the next launch of a job which is not launched yet",
+		}, []string{"job"})),
+		unhandled: register(registerer, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "stepper_unhandled_tasks",
+			Help: "Due tasks which have no handler on any alive node",
+		}, []string{"task"})),
+	}
+}
+
+// legacyMetricsCollector is implemented by engines which still report their own deprecated metrics
+type legacyMetricsCollector interface {
+	CollectMetrics(ctx context.Context) error
+}
+
+func register[T prometheus.Collector](registerer prometheus.Registerer, collector T) T {
+	if err := registerer.Register(collector); err != nil {
+		var registered prometheus.AlreadyRegisteredError
+		if errors.As(err, &registered) {
+			return registered.ExistingCollector.(T)
+		}
+
+		panic(err)
+	}
+
+	return collector
+}
+
+func (s *Service) collectMetrics(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(s.metricsInterval):
+			if err := s.updateMetrics(ctx); err != nil {
+				s.logger.Error("cannot collect metrics", "error", err)
+			}
+		}
+	}
+}
+
+func (s *Service) updateMetrics(ctx context.Context) error {
+	if legacy, ok := s.mongo.(legacyMetricsCollector); ok {
+		if err := legacy.CollectMetrics(ctx); err != nil {
+			return fmt.Errorf("cannot collect engine metrics: %w", err)
+		}
+	}
+
+	stats, err := s.mongo.GetTaskStats(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot get task stats: %w", err)
+	}
+
+	jobs, err := s.jobEngine.GetJobs(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot get jobs: %w", err)
+	}
+
+	now := time.Now()
+
+	s.metrics.tasks.Reset()
+	s.metrics.queueLag.Reset()
+	s.metrics.dead.Reset()
+	s.metrics.jobLateness.Reset()
+
+	var waiting int64
+
+	// a name has a group per status, the oldest due task of all groups is reported
+	oldestDue := map[string]time.Time{}
+
+	for _, stat := range stats {
+		s.metrics.tasks.WithLabelValues(stat.Name, stat.Status).Set(float64(stat.Count))
+
+		switch stat.Status {
+		case "waiting":
+			waiting += stat.Count
+		case "dead", "dead_letter":
+			s.metrics.dead.WithLabelValues(stat.Name).Add(float64(stat.Count))
+		}
+
+		if oldest, ok := oldestDue[stat.Name]; !stat.OldestDueAt.IsZero() && (!ok || stat.OldestDueAt.Before(oldest)) {
+			oldestDue[stat.Name] = stat.OldestDueAt
+		}
+	}
+
+	for name, oldest := range oldestDue {
+		s.metrics.queueLag.WithLabelValues(name).Set(now.Sub(oldest).Seconds())
+	}
+
+	s.metrics.waiting.Set(float64(waiting))
+
+	for _, job := range jobs {
+		lateness := time.Duration(0)
+
+		if (job.Status == "created" || job.Status == "released") && job.NextLaunchAt.Before(now) {
+			lateness = now.Sub(job.NextLaunchAt)
+		}
+
+		s.metrics.jobLateness.WithLabelValues(job.Name).Set(lateness.Seconds())
+	}
+
+	return nil
+}
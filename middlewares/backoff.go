@@ -0,0 +1,90 @@
+package middlewares
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+const maxDelay = time.Duration(math.MaxInt64)
+
+// Backoff returns a delay before the next attempt, attempt starts from 1
+// and previous is the delay before the failed attempt, it is zero for the first one.
+type Backoff interface {
+	Next(attempt int, previous time.Duration, err error) time.Duration
+}
+
+// BackoffFunc is a custom backoff which doesn't depend on the previous delay.
+type BackoffFunc func(attempt int, err error) time.Duration
+
+func (f BackoffFunc) Next(attempt int, previous time.Duration, err error) time.Duration {
+	return f(attempt, err)
+}
+
+func Constant(interval time.Duration) Backoff {
+	return BackoffFunc(func(attempt int, err error) time.Duration {
+		return interval
+	})
+}
+
+// Exponential doubles the delay on every attempt up to max, zero max means no limit.
+func Exponential(base, max time.Duration) Backoff {
+	return BackoffFunc(func(attempt int, err error) time.Duration {
+		return exponential(base, max, attempt)
+	})
+}
+
+// FullJitter returns a random delay between zero and the exponential delay.
+func FullJitter(base, max time.Duration) Backoff {
+	return BackoffFunc(func(attempt int, err error) time.Duration {
+		return randomBetween(0, exponential(base, max, attempt))
+	})
+}
+
+type decorrelatedJitter struct {
+	base time.Duration
+	max  time.Duration
+}
+
+// DecorrelatedJitter returns a random delay between base and triple of the previous delay up to max.
+func DecorrelatedJitter(base, max time.Duration) Backoff {
+	return decorrelatedJitter{base: base, max: max}
+}
+
+func (j decorrelatedJitter) Next(attempt int, previous time.Duration, err error) time.Duration {
+	upper := maxDelay
+	if previous < maxDelay/3 {
+		upper = previous * 3
+	}
+
+	return capDelay(randomBetween(j.base, upper), j.max)
+}
+
+func exponential(base, max time.Duration, attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	delay := float64(base) * math.Pow(2, float64(attempt-1))
+	if delay >= float64(maxDelay) {
+		return capDelay(maxDelay, max)
+	}
+
+	return capDelay(time.Duration(delay), max)
+}
+
+func capDelay(delay, max time.Duration) time.Duration {
+	if max > 0 && delay > max {
+		return max
+	}
+
+	return delay
+}
+
+func randomBetween(min, max time.Duration) time.Duration {
+	if max <= min {
+		return min
+	}
+
+	return min + time.Duration(rand.Int63n(int64(max-min)))
+}
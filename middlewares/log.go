@@ -2,10 +2,13 @@ package middlewares
 
 import (
 	"fmt"
+	"time"
+	"unicode/utf8"
 
 	"github.com/matroskin13/stepper"
 )
 
+// Deprecated: use Log, LogMiddleware prints the whole data of tasks.
 func LogMiddleware() stepper.MiddlewareHandler {
 	return func(next stepper.MiddlewareFunc) stepper.MiddlewareFunc {
 		return func(ctx stepper.Context, t *stepper.Task) error {
@@ -22,3 +25,60 @@ func LogMiddleware() stepper.MiddlewareHandler {
 		}
 	}
 }
+
+type LogOptions struct {
+	// MaxDataLength truncates data of tasks in logs, the data is logged only if MaxDataLength or Redact is set
+	MaxDataLength int
+	// Redact replaces data of a task before logging, e.g. to hide personal data
+	Redact func(task *stepper.Task, data []byte) []byte
+}
+
+// Log writes structured logs of task executions by the logger.
+func Log(logger stepper.Logger, options LogOptions) stepper.MiddlewareHandler {
+	return func(next stepper.MiddlewareFunc) stepper.MiddlewareFunc {
+		return func(ctx stepper.Context, t *stepper.Task) error {
+			attrs := []any{"task_id", t.ID, "task", t.Name, "attempt", t.Attempt}
+
+			if options.MaxDataLength > 0 || options.Redact != nil {
+				attrs = append(attrs, "data", logData(t, options))
+			}
+
+			logger.Info("take task", attrs...)
+
+			startedAt := time.Now()
+
+			err := next(ctx, t)
+
+			attrs = append(attrs, "duration", time.Since(startedAt))
+
+			if err != nil {
+				logger.Error("task has error", append(attrs, "error", err)...)
+			} else {
+				logger.Info("complete task", attrs...)
+			}
+
+			return err
+		}
+	}
+}
+
+func logData(t *stepper.Task, options LogOptions) string {
+	data := t.Data
+
+	if options.Redact != nil {
+		data = options.Redact(t, data)
+	}
+
+	if options.MaxDataLength > 0 && len(data) > options.MaxDataLength {
+		end := options.MaxDataLength
+
+		// a multibyte character is not cut in the middle
+		for end > 0 && !utf8.RuneStart(data[end]) {
+			end--
+		}
+
+		return string(data[:end]) + "..."
+	}
+
+	return string(data)
+}
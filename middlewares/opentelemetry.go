@@ -0,0 +1,65 @@
+package middlewares
+
+import (
+	"context"
+	"errors"
+
+	"github.com/matroskin13/stepper"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/matroskin13/stepper/middlewares"
+
+var traceContextPropagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+type tracePropagator struct{}
+
+// TracePropagator propagates W3C trace context and baggage from Publish to OpenTelemetry middleware,
+// it must be passed to stepper.WithPropagator.
+func TracePropagator() stepper.Propagator {
+	return tracePropagator{}
+}
+
+func (tracePropagator) Inject(ctx context.Context, carrier map[string]string) {
+	traceContextPropagator.Inject(ctx, propagation.MapCarrier(carrier))
+}
+
+// OpenTelemetry creates a span per execution of a task. The span continues the trace of the publisher
+// and subtasks created by the handler continue the trace of the span.
+func OpenTelemetry(tracerProvider trace.TracerProvider) stepper.MiddlewareHandler {
+	tracer := tracerProvider.Tracer(tracerName)
+
+	return func(next stepper.MiddlewareFunc) stepper.MiddlewareFunc {
+		return func(ctx stepper.Context, t *stepper.Task) error {
+			parent := traceContextPropagator.Extract(ctx.Context(), propagation.MapCarrier(t.TraceContext))
+
+			spanCtx, span := tracer.Start(
+				parent,
+				t.Name,
+				trace.WithSpanKind(trace.SpanKindConsumer),
+				trace.WithAttributes(
+					attribute.String("stepper.task.name", t.Name),
+					attribute.String("stepper.task.id", t.ID),
+					attribute.Int("stepper.task.attempt", t.Attempt),
+					attribute.String("stepper.task.parent", t.Parent),
+					attribute.String("stepper.task.job_id", t.JobId),
+				),
+			)
+			defer span.End()
+
+			ctx.SetContext(spanCtx)
+
+			err := next(ctx, t)
+
+			if err != nil && !errors.Is(err, stepper.ErrTaskSuspended) {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+
+			return err
+		}
+	}
+}
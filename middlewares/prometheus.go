@@ -1,6 +1,7 @@
 package middlewares
 
 import (
+	"errors"
 	"time"
 
 	"github.com/matroskin13/stepper"
@@ -44,6 +45,10 @@ func (p *Prometheus) GetMiddleware() stepper.MiddlewareHandler {
 			err := next(ctx, t)
 
 			status := lo.Ternary(err == nil, "success", "fail")
+			if errors.Is(err, stepper.ErrTaskSuspended) {
+				status = "suspended"
+			}
+
 			duration := time.Since(startTime)
 
 			p.total.WithLabelValues(t.Name, status).Inc()
@@ -2,6 +2,7 @@ package middlewares
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
@@ -10,11 +11,20 @@ import (
 
 type RetryOptions struct {
 	MaxRetries int
-	Interval   time.Duration
+	// Interval is a constant delay between attempts, it is used when Backoff is not set
+	Interval time.Duration
+	Backoff  Backoff
+	// RetryIf reports whether an error can be retried, all errors are retried by default
+	RetryIf func(err error) bool
+	// Deadline limits the total time of retries since the first attempt
+	Deadline time.Duration
 }
 
 type retryState struct {
-	Attempt int
+	Attempt   int
+	StartedAt time.Time
+	// Delay is the last delay between attempts
+	Delay time.Duration
 }
 
 func Retry(options RetryOptions) stepper.MiddlewareHandler {
@@ -22,24 +32,53 @@ func Retry(options RetryOptions) stepper.MiddlewareHandler {
 		options.Interval = time.Second * 10
 	}
 
+	if options.Backoff == nil {
+		options.Backoff = Constant(options.Interval)
+	}
+
 	return func(next stepper.MiddlewareFunc) stepper.MiddlewareFunc {
 		return func(ctx stepper.Context, t *stepper.Task) error {
 			var state retryState
 
 			json.Unmarshal(t.MiddlewaresState["__retry"], &state)
 
+			if state.StartedAt.IsZero() {
+				state.StartedAt = time.Now()
+			}
+
 			if err := next(ctx, t); err != nil {
+				if errors.Is(err, stepper.ErrTaskSuspended) {
+					return err
+				}
+
+				if stepper.IsPermanent(err) || (options.RetryIf != nil && !options.RetryIf(err)) {
+					ctx.SetRetryAfter(-1)
+					return err
+				}
+
 				state.Attempt += 1
 
+				delay, ok := stepper.RetryDelay(err)
+				if !ok {
+					delay = options.Backoff.Next(state.Attempt, state.Delay, err)
+				}
+
+				state.Delay = delay
+
 				newState, _ := json.Marshal(state)
 				t.MiddlewaresState["__retry"] = newState
 
 				if state.Attempt >= options.MaxRetries {
 					ctx.SetRetryAfter(-1)
-					return fmt.Errorf("a retry limit is exceeded")
+					return fmt.Errorf("a retry limit is exceeded: %w", err)
+				}
+
+				if options.Deadline > 0 && time.Since(state.StartedAt)+delay > options.Deadline {
+					ctx.SetRetryAfter(-1)
+					return fmt.Errorf("a retry deadline is exceeded: %w", err)
 				}
 
-				ctx.SetRetryAfter(options.Interval)
+				ctx.SetRetryAfter(delay)
 
 				return err
 			}
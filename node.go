@@ -0,0 +1,72 @@
+package stepper
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/samber/lo"
+)
+
+const (
+	nodeHeartbeatInterval = time.Second * 15
+	// a node is alive if it has sent a heartbeat within the timeout
+	nodeAliveTimeout = nodeHeartbeatInterval * 4
+	// nodes which are not seen for a long time are removed from the registry
+	nodeExpireTimeout = time.Hour
+)
+
+// Node is an instance of a service which listens tasks and jobs.
+type Node struct {
+	ID   string
+	Jobs []string
+	// Tasks contains names of tasks which the node can handle
+	Tasks []string
+	// Queues and Tags restrict tasks which the node claims, see ClaimFilter
+	Queues []string
+	Tags   []string
+	SeenAt time.Time
+}
+
+func (s *Service) node() *Node {
+	return &Node{
+		ID:     s.nodeId,
+		Jobs:   lo.Keys(s.jobs),
+		Tasks:  s.taskClaimFilter().Names,
+		Queues: s.queues,
+		Tags:   s.tags(),
+		SeenAt: time.Now(),
+	}
+}
+
+func (s *Service) heartbeat(ctx context.Context) error {
+	if err := s.mongo.DeleteNodes(ctx, time.Now().Add(-nodeExpireTimeout)); err != nil {
+		return fmt.Errorf("cannot delete expired nodes: %w", err)
+	}
+
+	return s.mongo.SaveNode(ctx, s.node())
+}
+
+func (s *Service) listenHeartbeats(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(nodeHeartbeatInterval):
+			if err := s.heartbeat(ctx); err != nil {
+				s.logger.Error("cannot send heartbeat", "node", s.nodeId, "error", err)
+			}
+		}
+	}
+}
+
+// aliveNodes returns nodes which have sent a heartbeat recently. The current node is always alive,
+// so an empty list means the registry is not ready and ok is false.
+func (s *Service) aliveNodes(ctx context.Context) (nodes []*Node, ok bool, err error) {
+	nodes, err = s.mongo.GetNodes(ctx, time.Now().Add(-nodeAliveTimeout))
+	if err != nil {
+		return nil, false, fmt.Errorf("cannot get alive nodes: %w", err)
+	}
+
+	return nodes, len(nodes) > 0, nil
+}
@@ -0,0 +1,62 @@
+package stepper
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/samber/lo"
+)
+
+type ServiceOption func(s *Service)
+
+// WithNodeTags sets tags of the node. The node claims only tasks and jobs which tags are all in the set,
+// tasks and jobs without tags are claimed by any node.
+func WithNodeTags(tags ...string) ServiceOption {
+	return func(s *Service) {
+		s.nodeTags = tags
+	}
+}
+
+// WithQueues subscribes the node to the queues instead of the default one, use DefaultQueue to keep it.
+func WithQueues(queues ...string) ServiceOption {
+	return func(s *Service) {
+		s.queues = queues
+	}
+}
+
+// WithMetricsInterval sets how often the engine metrics are collected, 15 seconds by default.
+func WithMetricsInterval(interval time.Duration) ServiceOption {
+	return func(s *Service) {
+		s.metricsInterval = interval
+	}
+}
+
+// WithMetricsRegisterer sets the registerer of the queue metrics, prometheus.DefaultRegisterer by default.
+func WithMetricsRegisterer(registerer prometheus.Registerer) ServiceOption {
+	return func(s *Service) {
+		s.registerer = registerer
+	}
+}
+
+func (s *Service) taskClaimFilter() ClaimFilter {
+	names := make([]string, 0, len(s.taskHandlers)*3+len(s.jobs))
+
+	for name := range s.taskHandlers {
+		names = append(names, name, "__subtask:"+name, compensationPrefix+name)
+	}
+
+	for name := range s.jobs {
+		names = append(names, "__job:"+name)
+	}
+
+	return ClaimFilter{Tags: s.tags(), Names: names, Queues: s.queues}
+}
+
+func (s *Service) jobClaimFilter() ClaimFilter {
+	return ClaimFilter{Tags: s.tags(), Names: lo.Keys(s.jobs)}
+}
+
+// tags returns a non-nil list, so the node does not claim work with tags if it has no tags
+func (s *Service) tags() []string {
+	return append([]string{}, s.nodeTags...)
+}
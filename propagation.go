@@ -0,0 +1,32 @@
+package stepper
+
+import "context"
+
+// Propagator injects a trace context into a task on publishing, the context is extracted by a middleware on handling.
+type Propagator interface {
+	Inject(ctx context.Context, carrier map[string]string)
+}
+
+// WithPropagator sets the propagator of trace contexts from publishers and parent tasks to handlers.
+func WithPropagator(propagator Propagator) ServiceOption {
+	return func(s *Service) {
+		s.propagator = propagator
+	}
+}
+
+// traceContext returns a trace context of ctx or nil if there is nothing to propagate
+func (s *Service) traceContext(ctx context.Context) map[string]string {
+	if s.propagator == nil {
+		return nil
+	}
+
+	carrier := map[string]string{}
+
+	s.propagator.Inject(ctx, carrier)
+
+	if len(carrier) == 0 {
+		return nil
+	}
+
+	return carrier
+}
@@ -15,3 +15,39 @@ func LaunchAt(t time.Time) PublishOption {
 		c.LaunchAt = t
 	}
 }
+
+func SetHeader(key, value string) PublishOption {
+	return func(c *CreateTask) {
+		if c.Headers == nil {
+			c.Headers = map[string]string{}
+		}
+
+		c.Headers[key] = value
+	}
+}
+
+// SetCustomId sets a custom id of the task, it can be used to send signals to the task.
+// Tasks of handlers with DependOnCustomId run one by one if they have the same custom id.
+func SetCustomId(id string) PublishOption {
+	return func(c *CreateTask) {
+		c.CustomId = id
+	}
+}
+
+func SetTags(tags ...string) PublishOption {
+	return func(c *CreateTask) {
+		c.Tags = tags
+	}
+}
+
+func SetQueue(queue string) PublishOption {
+	return func(c *CreateTask) {
+		c.Queue = queue
+	}
+}
+
+func SetHeaders(headers map[string]string) PublishOption {
+	return func(c *CreateTask) {
+		c.Headers = mergeHeaders(c.Headers, headers)
+	}
+}
@@ -0,0 +1,109 @@
+package stepper
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/samber/lo"
+)
+
+// idleJobStatuses are statuses of jobs which can be marked as orphaned
+var idleJobStatuses = []string{"created", "released"}
+
+type JobReconciliation struct {
+	// Interval between checks, a minute by default
+	Interval time.Duration
+	// DeleteAfter is a grace period after which orphaned jobs are deleted, orphaned jobs are kept if it is zero
+	DeleteAfter time.Duration
+	OnReport    func(report *ReconciliationReport)
+}
+
+type ReconciliationReport struct {
+	// Orphaned contains jobs which have been marked as orphaned during the check
+	Orphaned []string
+	Deleted  []string
+	Nodes    int
+}
+
+// WithJobReconciliation marks jobs which are not registered by any alive node as orphaned.
+// Orphaned jobs are not launched, and they are restored if some node registers them again.
+func WithJobReconciliation(cfg JobReconciliation) ServiceOption {
+	return func(s *Service) {
+		if cfg.Interval == 0 {
+			cfg.Interval = time.Minute
+		}
+
+		s.reconciliation = &cfg
+	}
+}
+
+func (s *Service) listenReconciliation(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(s.reconciliation.Interval):
+			report, err := s.reconcileJobs(ctx)
+			if err != nil {
+				s.logger.Error("cannot reconcile jobs", "error", err)
+				continue
+			}
+
+			if s.reconciliation.OnReport != nil {
+				s.reconciliation.OnReport(report)
+			}
+		}
+	}
+}
+
+func (s *Service) reconcileJobs(ctx context.Context) (*ReconciliationReport, error) {
+	nodes, ok, err := s.aliveNodes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ReconciliationReport{Nodes: len(nodes)}
+
+	if !ok {
+		return report, nil
+	}
+
+	registered := map[string]bool{}
+	for _, node := range nodes {
+		for _, job := range node.Jobs {
+			registered[job] = true
+		}
+	}
+
+	jobs, err := s.jobEngine.GetJobs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get jobs: %w", err)
+	}
+
+	for _, job := range jobs {
+		if registered[job.Name] {
+			continue
+		}
+
+		switch {
+		case job.Status == "orphaned":
+			if s.reconciliation.DeleteAfter > 0 && time.Since(job.OrphanedAt) > s.reconciliation.DeleteAfter {
+				if err := s.jobEngine.DeleteJob(ctx, job.Name); err != nil {
+					return nil, fmt.Errorf("cannot delete orphaned job=%s: %w", job.Name, err)
+				}
+
+				report.Deleted = append(report.Deleted, job.Name)
+			}
+		// a job in flight is orphaned by one of the next checks after its run is finished
+		case lo.Contains(idleJobStatuses, job.Status):
+			if err := s.jobEngine.MarkJobOrphaned(ctx, job.Name); err != nil {
+				return nil, fmt.Errorf("cannot mark job=%s as orphaned: %w", job.Name, err)
+			}
+
+			report.Orphaned = append(report.Orphaned, job.Name)
+		}
+	}
+
+	return report, nil
+}
@@ -0,0 +1,214 @@
+package stepper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rs/xid"
+	"github.com/samber/lo"
+)
+
+const (
+	SagaRunning      = "running"
+	SagaCompleted    = "completed"
+	SagaCompensating = "compensating"
+	SagaCompensated  = "compensated"
+	SagaFailed       = "failed"
+)
+
+const (
+	sagaPrefix         = "__saga:"
+	compensationPrefix = "__compensate:"
+)
+
+var ErrSagaNotFound = errors.New("saga not found")
+
+type Saga struct {
+	ID         string
+	Name       string
+	Status     string
+	Steps      []string
+	Step       int
+	FailedStep int
+}
+
+type sagaState struct {
+	Status     string   `json:"status"`
+	Steps      []string `json:"steps"`
+	Step       int      `json:"step"`
+	FailedStep int      `json:"failedStep"`
+}
+
+func (s *Service) RegisterSaga(name string, steps ...string) {
+	s.sagas[name] = steps
+
+	s.taskHandlers[sagaPrefix+name] = &handlerStruct{
+		handler:  s.startSagaStep,
+		onFinish: s.continueSaga,
+	}
+}
+
+func (s *Service) StartSaga(ctx context.Context, name string, data []byte, options ...PublishOption) (string, error) {
+	steps, ok := s.sagas[name]
+	if !ok {
+		return "", fmt.Errorf("saga=%s is not registered", name)
+	}
+
+	created := &CreateTask{}
+
+	for _, option := range options {
+		option(created)
+	}
+
+	launchAt := lo.Ternary(!created.LaunchAt.IsZero(), created.LaunchAt, time.Now())
+	if created.LaunchAfter != 0 {
+		launchAt = time.Now().Add(created.LaunchAfter)
+	}
+
+	state, err := json.Marshal(sagaState{
+		Status:     SagaRunning,
+		Steps:      steps,
+		FailedStep: -1,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	task := &Task{
+		ID:               xid.New().String(),
+		Name:             sagaPrefix + name,
+		Data:             data,
+		LaunchAt:         launchAt,
+		Status:           "created",
+		State:            state,
+		MiddlewaresState: map[string][]byte{},
+		Headers:          created.Headers,
+		Tags:             created.Tags,
+		Queue:            created.Queue,
+		TraceContext:     s.traceContext(ctx),
+	}
+
+	if err := s.mongo.CreateTask(ctx, task); err != nil {
+		return "", err
+	}
+
+	s.emit(ctx, Event{Type: EventPublished, Task: task})
+
+	return task.ID, nil
+}
+
+func (s *Service) GetSaga(ctx context.Context, id string) (*Saga, error) {
+	task, err := s.mongo.GetTask(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if task == nil || !strings.HasPrefix(task.Name, sagaPrefix) {
+		return nil, ErrSagaNotFound
+	}
+
+	var state sagaState
+
+	if err := json.Unmarshal(task.State, &state); err != nil {
+		return nil, fmt.Errorf("cannot decode state of saga=%s: %w", id, err)
+	}
+
+	return &Saga{
+		ID:         task.ID,
+		Name:       strings.TrimPrefix(task.Name, sagaPrefix),
+		Status:     state.Status,
+		Steps:      state.Steps,
+		Step:       state.Step,
+		FailedStep: state.FailedStep,
+	}, nil
+}
+
+func (s *Service) startSagaStep(ctx Context, data []byte) error {
+	var state sagaState
+
+	if err := ctx.BindState(&state); err != nil {
+		return err
+	}
+
+	if len(state.Steps) == 0 {
+		state.Status = SagaCompleted
+		return ctx.SetState(state)
+	}
+
+	ctx.CreateSubtask(CreateTask{
+		Name: state.Steps[state.Step],
+		Data: data,
+	})
+
+	return nil
+}
+
+// continueSaga is called every time the current step (or compensation) of a saga is over
+// and decides which subtask has to be launched next.
+func (s *Service) continueSaga(ctx Context, data []byte) error {
+	var state sagaState
+
+	if err := ctx.BindState(&state); err != nil {
+		return err
+	}
+
+	children, err := s.mongo.GetTaskChildren(ctx.Context(), ctx.Task().ID)
+	if err != nil {
+		return err
+	}
+
+	if len(children) == 0 {
+		return nil
+	}
+
+	last := children[len(children)-1]
+
+	switch state.Status {
+	case SagaRunning:
+		if last.IsDead() {
+			state.Status = SagaCompensating
+			state.FailedStep = state.Step
+			state.Step--
+			break
+		}
+
+		state.Step++
+
+		if state.Step == len(state.Steps) {
+			state.Status = SagaCompleted
+			return ctx.SetState(state)
+		}
+
+		ctx.CreateSubtask(CreateTask{
+			Name: state.Steps[state.Step],
+			Data: data,
+		})
+
+		return ctx.SetState(state)
+	case SagaCompensating:
+		if last.IsDead() {
+			state.Status = SagaFailed
+			return ctx.SetState(state)
+		}
+
+		state.Step--
+	default:
+		return nil
+	}
+
+	if state.Step < 0 {
+		state.Status = SagaCompensated
+		return ctx.SetState(state)
+	}
+
+	ctx.CreateSubtask(CreateTask{
+		Name: compensationPrefix + state.Steps[state.Step],
+		Data: data,
+	})
+
+	return ctx.SetState(state)
+}
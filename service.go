@@ -2,11 +2,15 @@ package stepper
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/xid"
 	"github.com/samber/lo"
 	"golang.org/x/sync/errgroup"
@@ -15,10 +19,16 @@ import (
 type Handler func(ctx Context, data []byte) error
 type JobHandler func(ctx Context) error
 
+const (
+	defaultMetricsInterval = time.Second * 15
+	relatedTaskDelay       = time.Second
+)
+
 type handlerStruct struct {
 	handler          Handler
 	onFinish         Handler
 	onSubtask        Handler
+	compensate       Handler
 	middlewares      []MiddlewareHandler
 	jobHandler       JobHandler
 	jobConfig        *JobConfig
@@ -43,6 +53,12 @@ func (h *handlerStruct) Subtask(handler Handler) HandlerStruct {
 	return h
 }
 
+func (h *handlerStruct) Compensate(handler Handler) HandlerStruct {
+	h.compensate = handler
+
+	return h
+}
+
 func (h *handlerStruct) UseMiddleware(middlewares ...MiddlewareHandler) {
 	h.middlewares = middlewares
 }
@@ -50,6 +66,7 @@ func (h *handlerStruct) UseMiddleware(middlewares ...MiddlewareHandler) {
 type HandlerStruct interface {
 	OnFinish(h Handler) HandlerStruct
 	Subtask(handler Handler) HandlerStruct
+	Compensate(handler Handler) HandlerStruct
 	UseMiddleware(middlewares ...MiddlewareHandler)
 	DependOnCustomId() HandlerStruct
 }
@@ -59,30 +76,66 @@ type Service struct {
 	jobEngine JobEngine
 
 	jobs         map[string]*handlerStruct
+	jobErrors    []error
 	taskHandlers map[string]*handlerStruct
+	sagas        map[string][]string
 
 	middlewares []MiddlewareHandler
+
+	nodeId          string
+	nodeTags        []string
+	queues          []string
+	reconciliation  *JobReconciliation
+	unhandled       UnhandledTasks
+	metricsInterval time.Duration
+	registerer      prometheus.Registerer
+	metrics         *metrics
+	propagator      Propagator
+	logger          Logger
+	listeners       []EventListener
+	listenersMu     sync.RWMutex
 }
 
-func NewService(engine Engine) Stepper {
-	return &Service{
-		jobs:         map[string]*handlerStruct{},
-		taskHandlers: map[string]*handlerStruct{},
-		mongo:        engine,
-		jobEngine:    engine,
+func NewService(engine Engine, options ...ServiceOption) Stepper {
+	s := &Service{
+		jobs:            map[string]*handlerStruct{},
+		taskHandlers:    map[string]*handlerStruct{},
+		sagas:           map[string][]string{},
+		mongo:           engine,
+		jobEngine:       engine,
+		nodeId:          xid.New().String(),
+		queues:          []string{DefaultQueue},
+		metricsInterval: defaultMetricsInterval,
+		registerer:      prometheus.DefaultRegisterer,
+		logger:          newStdLogger(),
 	}
+
+	for _, option := range options {
+		option(s)
+	}
+
+	s.metrics = newMetrics(s.registerer)
+
+	return s
 }
 
 func (s *Service) UseMiddleware(h MiddlewareHandler) {
 	s.middlewares = append(s.middlewares, h)
 }
 
+// RegisterJob validates the config, an invalid job like a broken cron pattern or an unknown timezone
+// is not registered and its error is returned by Listen.
 func (s *Service) RegisterJob(ctx context.Context, config *JobConfig, h JobHandler) HandlerStruct {
 	hs := handlerStruct{
 		jobHandler: h,
 		jobConfig:  config,
 	}
 
+	if err := config.Validate(); err != nil {
+		s.jobErrors = append(s.jobErrors, err)
+		return &hs
+	}
+
 	s.jobs[config.Name] = &hs
 
 	return &hs
@@ -105,7 +158,7 @@ func (s *Service) createTask(ctx context.Context, task *CreateTask) error {
 		launchAt = time.Now().Add(task.LaunchAfter)
 	}
 
-	return s.mongo.CreateTask(ctx, &Task{
+	created := &Task{
 		Name:             task.Name,
 		Data:             task.Data,
 		LaunchAt:         launchAt,
@@ -113,7 +166,19 @@ func (s *Service) createTask(ctx context.Context, task *CreateTask) error {
 		ID:               xid.New().String(),
 		MiddlewaresState: map[string][]byte{},
 		CustomId:         task.CustomId,
-	})
+		Headers:          task.Headers,
+		Tags:             task.Tags,
+		Queue:            task.Queue,
+		TraceContext:     s.traceContext(ctx),
+	}
+
+	if err := s.mongo.CreateTask(ctx, created); err != nil {
+		return err
+	}
+
+	s.emit(ctx, Event{Type: EventPublished, Task: created})
+
+	return nil
 }
 
 func (s *Service) Publish(ctx context.Context, name string, data []byte, options ...PublishOption) error {
@@ -130,6 +195,10 @@ func (s *Service) Publish(ctx context.Context, name string, data []byte, options
 }
 
 func (s *Service) Listen(ctx context.Context) error {
+	if len(s.jobErrors) > 0 {
+		return fmt.Errorf("cannot register jobs: %w", s.jobErrors[0])
+	}
+
 	if err := s.jobEngine.Init(ctx); err != nil {
 		return err
 	}
@@ -140,6 +209,10 @@ func (s *Service) Listen(ctx context.Context) error {
 		}
 	}
 
+	if err := s.heartbeat(ctx); err != nil {
+		return fmt.Errorf("cannot register node: %w", err)
+	}
+
 	g, gCtx := errgroup.WithContext(ctx)
 
 	g.Go(func() error {
@@ -162,20 +235,21 @@ func (s *Service) Listen(ctx context.Context) error {
 		return s.collectMetrics(ctx)
 	})
 
-	return g.Wait()
-}
+	g.Go(func() error {
+		return s.listenHeartbeats(ctx)
+	})
 
-func (s *Service) collectMetrics(ctx context.Context) error {
-	for {
-		select {
-		case <-ctx.Done():
-			return nil
-		case <-time.After(time.Second * 15):
-			if err := s.mongo.CollectMetrics(ctx); err != nil {
-				fmt.Println(err)
-			}
-		}
+	g.Go(func() error {
+		return s.listenUnhandledTasks(ctx)
+	})
+
+	if s.reconciliation != nil {
+		g.Go(func() error {
+			return s.listenReconciliation(ctx)
+		})
 	}
+
+	return g.Wait()
 }
 
 func (s *Service) handleTask(ctx context.Context, task *Task) error {
@@ -185,24 +259,30 @@ func (s *Service) handleTask(ctx context.Context, task *Task) error {
 	if task.JobId == "" {
 		name := task.Name
 		isThread := strings.Contains(name, "__subtask:")
+		isCompensation := strings.HasPrefix(name, compensationPrefix)
 
 		if isThread {
 			name = strings.TrimPrefix(name, "__subtask:")
 		}
 
+		if isCompensation {
+			name = strings.TrimPrefix(name, compensationPrefix)
+		}
+
 		_handler, ok := s.taskHandlers[name]
 		if !ok {
-			return nil
+			return s.handleUnhandledTask(ctx, task)
 		}
 
-		if _handler.dependOnCustomId {
+		if _handler.dependOnCustomId && task.CustomId != "" {
 			relatedTask, err := s.mongo.GetRelatedTask(ctx, task)
 			if err != nil {
 				return err
 			}
 
-			if relatedTask == nil {
-				return nil
+			// tasks with the same custom id run one by one in the order of publishing
+			if relatedTask != nil {
+				return s.mongo.SuspendTask(ctx, task, time.Now().Add(relatedTaskDelay))
 			}
 		}
 
@@ -213,10 +293,16 @@ func (s *Service) handleTask(ctx context.Context, task *Task) error {
 			_handler.onSubtask,
 			_handler.handler,
 		)
+
+		if isCompensation {
+			handler = lo.Ternary(_handler.compensate != nil, _handler.compensate, func(ctx Context, data []byte) error {
+				return nil
+			})
+		}
 	} else {
 		jobHandler, ok := s.jobs[task.JobId]
 		if !ok {
-			return nil
+			return s.handleUnhandledTask(ctx, task)
 		}
 
 		handlerMiddlewares = jobHandler.middlewares
@@ -224,8 +310,14 @@ func (s *Service) handleTask(ctx context.Context, task *Task) error {
 		handler = func(ctx Context, data []byte) error {
 			return jobHandler.jobHandler(ctx)
 		}
+
+		if err := s.markJobRunStarted(ctx, task); err != nil {
+			s.logger.Error("cannot start job run", taskAttrs(task, "error", err)...)
+		}
 	}
 
+	s.emit(ctx, Event{Type: EventClaimed, Task: task})
+
 	_ctx := &taskContext{task: task, ctx: ctx, taskEngine: s.mongo}
 
 	middlewares := lo.Flatten([][]MiddlewareHandler{s.middlewares, handlerMiddlewares})
@@ -236,55 +328,154 @@ func (s *Service) handleTask(ctx context.Context, task *Task) error {
 		return handler(_ctx, task.Data)
 	})
 
-	if err := finalHandler(_ctx, task); err != nil {
+	startedAt := time.Now()
+
+	s.logger.Debug("task is started", taskAttrs(task)...)
+
+	stopLease := s.keepLease(ctx, task)
+	err := finalHandler(_ctx, task)
+	stopLease()
+
+	if err != nil {
+		duration := time.Since(startedAt)
+
+		var suspended *suspendError
+		if errors.As(err, &suspended) {
+			s.logger.Debug("task is suspended", taskAttrs(task, "duration", duration, "until", suspended.until)...)
+
+			if err := s.mongo.SuspendTask(ctx, task, suspended.until); err != nil {
+				return err
+			}
+
+			if suspended.signal != "" {
+				return s.wakeOnSignal(ctx, task, suspended)
+			}
+
+			return nil
+		}
+
 		timeout := lo.Ternary(_ctx.retryAfter == 0, time.Second*10, _ctx.retryAfter)
-		if err := s.mongo.FailTask(ctx, task, err, timeout); err != nil {
+
+		if delay, ok := RetryDelay(err); ok && timeout != -1 {
+			timeout = delay
+		}
+
+		if IsPermanent(err) {
+			timeout = -1
 		}
+
+		if failErr := s.mongo.FailTask(ctx, task, err, timeout); failErr != nil {
+			return fmt.Errorf("cannot fail task: %w", failErr)
+		}
+
+		if timeout == -1 {
+			s.logger.Error("task is dead", taskAttrs(task, "duration", duration, "error", err)...)
+			s.emit(ctx, Event{Type: EventDead, Task: task, Err: err})
+		} else {
+			s.logger.Warn("task is failed", taskAttrs(task, "duration", duration, "retry_after", timeout, "error", err)...)
+			s.emit(ctx, Event{Type: EventFailed, Task: task, Err: err, RetryAt: time.Now().Add(timeout)})
+		}
+
+		if timeout == -1 && task.JobId != "" {
+			return s.finishConcurrentJobRun(ctx, task)
+		}
+
 		return nil
 	}
 
+	s.logger.Info("task is completed", taskAttrs(task, "duration", time.Since(startedAt), "subtasks", len(_ctx.subtasks))...)
+
 	if len(_ctx.subtasks) > 0 {
-		for _, subtask := range _ctx.subtasks {
-			name := subtask.Name
-			if name == "" {
-				name = "__subtask:" + task.Name
-			}
+		if err := s.createSubtasks(ctx, _ctx.Context(), task, _ctx.subtasks); err != nil {
+			return err
+		}
 
-			launchAt := lo.Ternary(!subtask.LaunchAt.IsZero(), subtask.LaunchAt, time.Now())
-			if subtask.LaunchAfter != 0 {
-				launchAt = time.Now().Add(subtask.LaunchAfter)
-			}
+		s.emit(ctx, Event{Type: EventSucceeded, Task: task})
 
-			if err := s.mongo.CreateTask(ctx, &Task{
-				Name:             name,
-				Parent:           task.ID,
-				Status:           "created",
-				LaunchAt:         launchAt,
-				Data:             subtask.Data,
-				ID:               xid.New().String(),
-				MiddlewaresState: map[string][]byte{},
-				CustomId:         subtask.CustomId,
-			}); err != nil {
-				return err
-			}
+		return nil
+	}
+
+	if err := s.mongo.ReleaseTask(ctx, task); err != nil {
+		return err
+	}
+
+	s.emit(ctx, Event{Type: EventSucceeded, Task: task})
+
+	if task.JobId != "" {
+		return s.finishConcurrentJobRun(ctx, task)
+	}
+
+	return nil
+}
+
+// keepLease renews the claim of the task until the returned function is called
+func (s *Service) keepLease(ctx context.Context, task *Task) func() {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		if err := s.mongo.KeepTaskLease(ctx, task); err != nil && ctx.Err() == nil {
+			s.logger.Warn("task lease is lost", taskAttrs(task, "error", err)...)
 		}
+	}()
 
-		if err := s.mongo.WaitTaskForSubtasks(ctx, task); err != nil {
-			return fmt.Errorf("cannot set WaitTaskForSubtasks: %w", err)
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// createSubtasks propagates the trace context of handlerCtx to subtasks, or the trace context of the task if handlerCtx has no one
+func (s *Service) createSubtasks(ctx context.Context, handlerCtx context.Context, task *Task, subtasks []CreateTask) error {
+	traceContext := s.traceContext(handlerCtx)
+	if traceContext == nil {
+		traceContext = task.TraceContext
+	}
+
+	for _, subtask := range subtasks {
+		name := subtask.Name
+		if name == "" {
+			name = "__subtask:" + task.Name
 		}
-	} else {
-		if err := s.mongo.ReleaseTask(ctx, task); err != nil {
+
+		launchAt := lo.Ternary(!subtask.LaunchAt.IsZero(), subtask.LaunchAt, time.Now())
+		if subtask.LaunchAfter != 0 {
+			launchAt = time.Now().Add(subtask.LaunchAfter)
+		}
+
+		if err := s.mongo.CreateTask(ctx, &Task{
+			Name:             name,
+			Parent:           task.ID,
+			Status:           "created",
+			LaunchAt:         launchAt,
+			Data:             subtask.Data,
+			ID:               xid.New().String(),
+			MiddlewaresState: map[string][]byte{},
+			CustomId:         subtask.CustomId,
+			Headers:          mergeHeaders(task.Headers, subtask.Headers),
+			Tags:             lo.Ternary(len(subtask.Tags) > 0, subtask.Tags, task.Tags),
+			Queue:            lo.Ternary(subtask.Queue != "", subtask.Queue, task.Queue),
+			TraceContext:     traceContext,
+		}); err != nil {
 			return err
 		}
 	}
 
+	if err := s.mongo.WaitTaskForSubtasks(ctx, task); err != nil {
+		return fmt.Errorf("cannot set WaitTaskForSubtasks: %w", err)
+	}
+
+	s.emit(ctx, Event{Type: EventSubtasksCreated, Task: task, Subtasks: len(subtasks)})
+
 	return nil
 }
 
 func (s *Service) ListenTasks(ctx context.Context) error {
 	pool := Pool(ctx, runtime.NumCPU(), func(task *Task) {
 		if err := s.handleTask(ctx, task); err != nil {
-			fmt.Println(err)
+			s.logger.Error("cannot handle task", taskAttrs(task, "error", err)...)
 		}
 	})
 
@@ -295,9 +486,9 @@ func (s *Service) ListenTasks(ctx context.Context) error {
 		case <-ctx.Done():
 			return nil
 		case <-time.After(interval):
-			task, err := s.mongo.FindNextTask(ctx, []string{"created", "in_progress", "failed"})
+			task, err := s.mongo.FindNextTask(ctx, []string{"created", "in_progress", "failed", "suspended"}, s.taskClaimFilter())
 			if err != nil {
-				fmt.Println(err)
+				s.logger.Error("cannot claim task", "error", err)
 				continue
 			}
 
@@ -322,18 +513,33 @@ func (s *Service) handleWaitingTask(ctx context.Context, task *Task) error {
 	if subtask == nil {
 		hs, ok := s.taskHandlers[task.Name]
 		if ok && task.JobId == "" && hs.onFinish != nil {
-			if err := hs.onFinish(&taskContext{ctx: ctx, task: task}, task.Data); err != nil {
-				// TODO need to fail the task
-				return nil
+			_ctx := &taskContext{ctx: ctx, task: task, taskEngine: s.mongo}
+
+			if err := hs.onFinish(_ctx, task.Data); err != nil {
+				s.logger.Error("cannot finish task", taskAttrs(task, "error", err)...)
+
+				// the task keeps waiting, so OnFinish is called again
+				return s.mongo.WaitTaskForSubtasks(ctx, task)
+			}
+
+			// OnFinish can continue the task with a new portion of subtasks
+			if len(_ctx.subtasks) > 0 {
+				return s.createSubtasks(ctx, _ctx.Context(), task, _ctx.subtasks)
 			}
 		}
 
 		if err := s.mongo.ReleaseTask(ctx, task); err != nil {
 			return fmt.Errorf("cannot release waiting task: %w", err)
 		}
+
+		s.emit(ctx, Event{Type: EventParentFinished, Task: task})
+
+		if task.JobId != "" {
+			return s.finishConcurrentJobRun(ctx, task)
+		}
 	} else {
 		if err := s.mongo.WaitTaskForSubtasks(ctx, task); err != nil {
-			return fmt.Errorf("cannot delay waiting subtask=%s: %w, %s, %s", task.ID, err, ctx.Err(), task.EngineContext.Err())
+			return fmt.Errorf("cannot delay waiting subtask=%s: %w", task.ID, err)
 		}
 	}
 
@@ -345,7 +551,7 @@ func (s *Service) ListenWaitingTasks(ctx context.Context) error {
 
 	pool := Pool(ctx, runtime.NumCPU(), func(task *Task) {
 		if err := s.handleWaitingTask(ctx, task); err != nil {
-			fmt.Println(err)
+			s.logger.Error("cannot handle waiting task", taskAttrs(task, "error", err)...)
 		}
 	})
 
@@ -354,8 +560,9 @@ func (s *Service) ListenWaitingTasks(ctx context.Context) error {
 		case <-ctx.Done():
 			return nil
 		case <-time.After(interval):
-			task, err := s.mongo.FindNextTask(ctx, []string{"waiting"})
+			task, err := s.mongo.FindNextTask(ctx, []string{"waiting"}, s.taskClaimFilter())
 			if err != nil {
+				s.logger.Error("cannot claim waiting task", "error", err)
 				continue
 			}
 
@@ -379,9 +586,9 @@ func (s *Service) ListenWaitingJobs(ctx context.Context) error {
 		case <-ctx.Done():
 			return nil
 		case <-time.After(time.Second):
-			job, err := s.jobEngine.FindNextJob(ctx, []string{"waiting"})
+			job, err := s.jobEngine.FindNextJob(ctx, []string{"waiting"}, s.jobClaimFilter())
 			if err != nil {
-				fmt.Println(err)
+				s.logger.Error("cannot claim waiting job", "error", err)
 				continue
 			}
 
@@ -389,7 +596,7 @@ func (s *Service) ListenWaitingJobs(ctx context.Context) error {
 				continue
 			}
 
-			subtask, err := s.jobEngine.GetUnreleasedJobChildren(ctx, job.Name)
+			subtask, err := s.jobEngine.GetUnreleasedJobChildren(ctx, job)
 			if err != nil {
 				return err
 			}
@@ -403,8 +610,22 @@ func (s *Service) ListenWaitingJobs(ctx context.Context) error {
 					}
 				}
 
-				job.CalculateNextLaunch()
-				if err := s.jobEngine.Release(ctx, job, job.NextLaunchAt); err != nil {
+				startedAt := job.ScheduledAt
+
+				run, err := s.finishJobRun(ctx, job.RunId)
+				if err != nil {
+					s.logger.Error("cannot finish job run", "job", job.Name, "run_id", job.RunId, "error", err)
+				}
+
+				if run != nil && !run.StartedAt.IsZero() {
+					startedAt = run.StartedAt
+				}
+
+				if err := job.calculateNextLaunch(startedAt); err != nil {
+					s.logger.Error("cannot calculate next launch", "job", job.Name, "error", err)
+				}
+
+				if err := s.releaseJob(ctx, job); err != nil {
 					return err
 				}
 			} else {
@@ -418,15 +639,33 @@ func (s *Service) ListenWaitingJobs(ctx context.Context) error {
 	}
 }
 
+func (s *Service) releaseJob(ctx context.Context, job *Job) error {
+	var err error
+
+	if job.IsRetired() {
+		err = s.jobEngine.RetireJob(ctx, job)
+	} else {
+		err = s.jobEngine.Release(ctx, job, job.NextLaunchAt)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	s.emit(ctx, Event{Type: EventJobReleased, Job: job})
+
+	return nil
+}
+
 func (s *Service) ListenJobs(ctx context.Context) error {
 	interval := time.Millisecond
 
 	for {
 		select {
 		case <-time.After(interval):
-			job, err := s.jobEngine.FindNextJob(ctx, []string{"in_progress", "created", "released"})
+			job, err := s.jobEngine.FindNextJob(ctx, []string{"in_progress", "created", "released"}, s.jobClaimFilter())
 			if err != nil {
-				fmt.Println(err)
+				s.logger.Error("cannot claim job", "error", err)
 				continue
 			}
 
@@ -435,24 +674,69 @@ func (s *Service) ListenJobs(ctx context.Context) error {
 				continue
 			}
 
+			interval = time.Millisecond
+
+			if job.MisfirePolicy == MisfireSkip && job.IsMisfired() {
+				if err := job.CalculateNextLaunch(); err != nil {
+					s.logger.Error("cannot calculate next launch", "job", job.Name, "error", err)
+				}
+
+				if err := s.releaseJob(ctx, job); err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			job.ScheduledAt = job.runScheduledAt(time.Now())
+
+			run, err := s.startJobRun(ctx, job)
+			if err != nil {
+				return err
+			}
+
+			job.RunId = run.ID
+
+			data, err := json.Marshal(run)
+			if err != nil {
+				return err
+			}
+
 			if err := s.mongo.CreateTask(ctx, &Task{
-				ID:               xid.New().String(),
+				ID:               run.TaskId,
 				Name:             "__job:" + job.Name,
 				JobId:            job.Name,
 				Status:           "created",
 				LaunchAt:         time.Now(),
-				Data:             nil,
+				Data:             data,
 				MiddlewaresState: map[string][]byte{},
 				CustomId:         "",
+				JobRunId:         run.ID,
+				Tags:             job.Tags,
+				// jobs are claimed only by nodes which register them
+				Headers: s.jobs[job.Name].jobConfig.Headers,
 			}); err != nil {
 				return err
 			}
 
+			s.emit(ctx, Event{Type: EventJobFired, Job: job})
+
+			// Concurrent runs are tracked by their tasks, so the job is ready for the next launch
+			if job.Overlap == OverlapAllow {
+				if err := job.CalculateNextLaunch(); err != nil {
+					s.logger.Error("cannot calculate next launch", "job", job.Name, "error", err)
+				}
+
+				if err := s.releaseJob(ctx, job); err != nil {
+					return err
+				}
+
+				continue
+			}
+
 			if err := s.jobEngine.WaitForSubtasks(ctx, job); err != nil {
 				return err
 			}
-
-			interval = time.Millisecond
 		case <-ctx.Done():
 			return nil
 		}
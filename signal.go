@@ -0,0 +1,102 @@
+package stepper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/xid"
+)
+
+var ErrSignalTimeout = errors.New("signal timeout")
+
+// a task without a timeout checks signals once a day in case of a lost wake up
+const signalRecheckInterval = time.Hour * 24
+
+type Signal struct {
+	ID        string
+	Target    string
+	Name      string
+	Payload   []byte
+	CreatedAt time.Time
+}
+
+// Signal sends an event to a task, the target is an id or a custom id of the task.
+func (s *Service) Signal(ctx context.Context, target string, name string, payload []byte) error {
+	return s.mongo.CreateSignal(ctx, &Signal{
+		ID:        xid.New().String(),
+		Target:    target,
+		Name:      name,
+		Payload:   payload,
+		CreatedAt: time.Now(),
+	})
+}
+
+// WaitForSignal returns a payload of the signal or suspends the task until the signal arrives.
+// The error of suspension must be returned from the handler. If the signal doesn't arrive in time,
+// ErrSignalTimeout is returned and the task will not be retried.
+func (c *taskContext) WaitForSignal(name string, timeout time.Duration) ([]byte, error) {
+	if c.signals == nil {
+		c.signals = map[string]int{}
+	}
+
+	c.signals[name]++
+
+	signals, err := c.taskEngine.GetSignals(c.ctx, c.task, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(signals) >= c.signals[name] {
+		return signals[c.signals[name]-1].Payload, nil
+	}
+
+	key := fmt.Sprintf("%s#%d", name, c.signals[name])
+	state, err := c.durableState()
+	if err != nil {
+		return nil, err
+	}
+
+	if state.Signals == nil {
+		state.Signals = map[string]time.Time{}
+	}
+
+	deadline, ok := state.Signals[key]
+	if !ok {
+		deadline = time.Now().Add(timeout)
+
+		if timeout <= 0 {
+			deadline = time.Time{}
+		}
+
+		state.Signals[key] = deadline
+		c.setDurableState(state)
+	}
+
+	if deadline.IsZero() {
+		return nil, &suspendError{until: time.Now().Add(signalRecheckInterval), signal: name, count: c.signals[name]}
+	}
+
+	if !time.Now().Before(deadline) {
+		c.SetRetryAfter(-1)
+		return nil, fmt.Errorf("%w: %s", ErrSignalTimeout, name)
+	}
+
+	return nil, &suspendError{until: deadline, signal: name, count: c.signals[name]}
+}
+
+// wakeOnSignal launches the suspended task if the signal arrived while the task was in progress,
+// such a signal doesn't wake the task because it is not suspended yet.
+func (s *Service) wakeOnSignal(ctx context.Context, task *Task, suspended *suspendError) error {
+	signals, err := s.mongo.GetSignals(ctx, task, suspended.signal)
+	if err != nil {
+		return err
+	}
+
+	if len(signals) < suspended.count {
+		return nil
+	}
+
+	return s.mongo.WakeTask(ctx, task.ID)
+}
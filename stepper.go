@@ -7,5 +7,17 @@ type Stepper interface {
 	Listen(ctx context.Context) error
 	Publish(ctx context.Context, name string, data []byte, options ...PublishOption) error
 	RegisterJob(ctx context.Context, config *JobConfig, h JobHandler) HandlerStruct
+	GetJobRuns(ctx context.Context, name string, limit int) ([]*JobRun, error)
+	PauseJob(ctx context.Context, name string) error
+	ResumeJob(ctx context.Context, name string) error
+	TriggerJob(ctx context.Context, name string) error
+	DeleteJob(ctx context.Context, name string) error
+	UpdateJobPattern(ctx context.Context, name string, pattern string) error
 	UseMiddleware(h MiddlewareHandler)
+	OnEvent(listener EventListener)
+	GetTaskTree(ctx context.Context, rootID string) (*TaskTree, error)
+	RegisterSaga(name string, steps ...string)
+	StartSaga(ctx context.Context, name string, data []byte, options ...PublishOption) (string, error)
+	GetSaga(ctx context.Context, id string) (*Saga, error)
+	Signal(ctx context.Context, target string, name string, payload []byte) error
 }
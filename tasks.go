@@ -2,32 +2,79 @@ package stepper
 
 import (
 	"context"
+	"errors"
 	"time"
 )
 
+var ErrTaskNotFound = errors.New("task not found")
+
+// DefaultQueue is the queue of tasks published without a queue.
+const DefaultQueue = ""
+
 type Task struct {
 	ID               string            `json:"_id"`
 	CustomId         string            `bson:"custom_id"`
 	Name             string            `json:"name"`
 	Data             []byte            `json:"data"`
 	JobId            string            `json:"jobId"`
+	JobRunId         string            `json:"jobRunId"`
 	Parent           string            `json:"parent"`
 	LaunchAt         time.Time         `json:"launchAt"`
 	Status           string            `json:"status"`
 	LockAt           *time.Time        `json:"lock_at"`
 	State            []byte            `json:"state"`
 	MiddlewaresState map[string][]byte `json:"middlewares_state"`
-	EngineContext    context.Context   `json:"-"`
+	Headers          map[string]string `json:"headers"`
+	Tags             []string          `json:"tags"`
+	Queue            string            `json:"queue"`
+	// Attempt is the number of launches of the task, it is set by the engine when the task is claimed.
+	// Launches which suspend the task (sleeps, signals, dependencies) are not counted
+	Attempt int `json:"attempt"`
+	// TraceContext carries a trace context of the publisher, see WithPropagator
+	TraceContext  map[string]string `json:"traceContext"`
+	EngineContext context.Context   `json:"-"`
 }
 
 func (t *Task) IsWaiting() bool {
 	return t.Status == "waiting"
 }
 
+func (t *Task) IsReleased() bool {
+	return t.Status == "released"
+}
+
+// IsDead reports whether the task has failed and will never be launched again.
+func (t *Task) IsDead() bool {
+	return t.Status == "failed" && t.LaunchAt.IsZero()
+}
+
 type CreateTask struct {
 	Name        string
 	Data        []byte
 	CustomId    string
 	LaunchAfter time.Duration
 	LaunchAt    time.Time
+	Headers     map[string]string
+	// Tags restrict nodes which can handle the task, see WithNodeTags. Subtasks inherit tags of the parent by default
+	Tags []string
+	// Queue of the task, subtasks are published to the queue of the parent by default
+	Queue string
+}
+
+func mergeHeaders(parent, child map[string]string) map[string]string {
+	if len(parent) == 0 && len(child) == 0 {
+		return nil
+	}
+
+	headers := make(map[string]string, len(parent)+len(child))
+
+	for k, v := range parent {
+		headers[k] = v
+	}
+
+	for k, v := range child {
+		headers[k] = v
+	}
+
+	return headers
 }
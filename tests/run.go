@@ -2,27 +2,61 @@ package tests
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/matroskin13/stepper"
+	"github.com/matroskin13/stepper/middlewares"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/xid"
 	"github.com/samber/lo"
 	"github.com/stretchr/testify/assert"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
-type ServiceCreator func() stepper.Stepper
+type ServiceCreator func(options ...stepper.ServiceOption) stepper.Stepper
 
 type TestFunc func(t *testing.T, ctx context.Context, taskService stepper.Stepper)
 
+type TestWithCreatorFunc func(t *testing.T, ctx context.Context, createService ServiceCreator)
+
+type TestWithEngineFunc func(t *testing.T, ctx context.Context, engine stepper.Engine, createService ServiceCreator)
+
 func Run(t *testing.T, taskService ServiceCreator) {
 	testCases := []TestFunc{
 		simplePublish,
 		publishAndRead,
 		generateSubtasks,
 		generateThreads,
+		waitForUnfinishedChildren,
 		failTask,
+		taskTree,
+		sagaCompensation,
+		durableSleep,
+		durableCheckpoint,
+		waitForSignal,
+		signalDuringHandler,
+		inheritHeaders,
+		inheritJobHeaders,
+		secondsJob,
+		jobRuns,
+		keepJobRuns,
+		manageJob,
+		pauseRunningJob,
+		overlapJob,
+		intervalAndOneOffJobs,
+		dependOnCustomId,
+		lifecycleEvents,
+		panickingListener,
+		classifyErrors,
+		retryBackoff,
+		countAttempts,
 	}
 
 	for _, testCase := range testCases {
@@ -32,6 +66,23 @@ func Run(t *testing.T, taskService ServiceCreator) {
 			cancel()
 		})
 	}
+
+	testWithCreatorCases := []TestWithCreatorFunc{
+		nodeTags,
+		namedQueues,
+		collectMetrics,
+		traceTasks,
+		structuredLogs,
+		invalidJobs,
+	}
+
+	for _, testCase := range testWithCreatorCases {
+		t.Run(getTestName(testCase), func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			testCase(t, ctx, taskService)
+			cancel()
+		})
+	}
 }
 
 func simplePublish(t *testing.T, ctx context.Context, taskService stepper.Stepper) {
@@ -85,6 +136,51 @@ func generateSubtasks(t *testing.T, ctx context.Context, taskService stepper.Ste
 	publishChannelWithTimeout(t, finishAfterAllSubtasks, struct{}{}, time.Second*5)
 }
 
+func waitForUnfinishedChildren(t *testing.T, ctx context.Context, taskService stepper.Stepper) {
+	name, child, grandchild := xid.New().String(), xid.New().String(), xid.New().String()
+
+	var done int32
+	finished := make(chan int32, 1)
+
+	taskService.TaskHandler(name, func(ctx stepper.Context, data []byte) error {
+		ctx.CreateSubtask(stepper.CreateTask{Name: child})
+		return nil
+	}).OnFinish(func(ctx stepper.Context, data []byte) error {
+		select {
+		case finished <- atomic.LoadInt32(&done):
+		default:
+		}
+
+		return nil
+	})
+
+	// the child is retried once and then waits for its own subtask
+	taskService.TaskHandler(child, func(ctx stepper.Context, data []byte) error {
+		if ctx.Attempt() == 1 {
+			ctx.SetRetryAfter(time.Second)
+			return errors.New("retry the child")
+		}
+
+		ctx.CreateSubtask(stepper.CreateTask{Name: grandchild})
+
+		return nil
+	})
+
+	taskService.TaskHandler(grandchild, func(ctx stepper.Context, data []byte) error {
+		time.Sleep(time.Second)
+		atomic.AddInt32(&done, 1)
+
+		return nil
+	})
+
+	assert.Nil(t, taskService.Publish(ctx, name, nil))
+
+	listen(t, ctx, taskService)
+
+	result := waitChannelWithTimeout(t, finished, time.Second*15, "wait for the parent")
+	assert.Equal(t, int32(1), result, "the parent must wait for the retried child and its subtasks")
+}
+
 func generateThreads(t *testing.T, ctx context.Context, taskService stepper.Stepper) {
 	name := xid.New().String()
 
@@ -122,6 +218,29 @@ func generateThreads(t *testing.T, ctx context.Context, taskService stepper.Step
 	assert.Equal(t, "2", string(<-subtasks))
 }
 
+// RunWithEngine runs tests which prepare or check the state of the engine directly
+func RunWithEngine(t *testing.T, engine stepper.Engine) {
+	createService := func(options ...stepper.ServiceOption) stepper.Stepper {
+		return stepper.NewService(engine, options...)
+	}
+
+	testCases := []TestWithEngineFunc{
+		reconcileJobs,
+		misfireJobs,
+		jitterFirstLaunch,
+		deadLetterUnhandled,
+		failUnhandled,
+	}
+
+	for _, testCase := range testCases {
+		t.Run(getTestName(testCase), func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			testCase(t, ctx, engine, createService)
+			cancel()
+		})
+	}
+}
+
 func failTask(t *testing.T, ctx context.Context, taskService stepper.Stepper) {
 	name := xid.New().String()
 
@@ -134,3 +253,1210 @@ func failTask(t *testing.T, ctx context.Context, taskService stepper.Stepper) {
 	d.OnTask(name, false, "wait for failed message")
 	assert.Equal(t, true, time.Now().After(startTime.Add(time.Second*2)), "failed message will receive without delay")
 }
+
+func taskTree(t *testing.T, ctx context.Context, taskService stepper.Stepper) {
+	name := xid.New().String()
+
+	rootId := make(chan string, 1)
+	finished := make(chan struct{}, 1)
+
+	taskService.Publish(ctx, name, nil)
+	taskService.TaskHandler(name, func(ctx stepper.Context, data []byte) error {
+		rootId <- ctx.Task().ID
+
+		for i := range lo.Range(3) {
+			ctx.CreateSubtask(stepper.CreateTask{
+				Data: []byte(fmt.Sprintf("%v", i)),
+			})
+		}
+
+		return nil
+	}).Subtask(func(ctx stepper.Context, data []byte) error {
+		return nil
+	}).OnFinish(func(ctx stepper.Context, data []byte) error {
+		finished <- struct{}{}
+		return nil
+	})
+
+	listen(t, ctx, taskService)
+
+	id := waitChannelWithTimeout(t, rootId, time.Second*5, "wait for root task")
+	waitChannelWithTimeout(t, finished, time.Second*10, "wait for subtasks")
+
+	tree, err := taskService.GetTaskTree(ctx, id)
+	assert.Nil(t, err)
+	assert.Len(t, tree.Children, 3)
+	assert.Equal(t, 3, tree.Progress.Total)
+	assert.Equal(t, 3, tree.Progress.Released)
+	assert.Equal(t, float64(100), tree.Progress.Percent())
+
+	_, err = taskService.GetTaskTree(ctx, xid.New().String())
+	assert.ErrorIs(t, err, stepper.ErrTaskNotFound)
+}
+
+func sagaCompensation(t *testing.T, ctx context.Context, taskService stepper.Stepper) {
+	name := xid.New().String()
+	steps := []string{xid.New().String(), xid.New().String(), xid.New().String()}
+
+	compensated := make(chan string, len(steps))
+
+	for _, step := range steps {
+		step := step
+
+		taskService.TaskHandler(step, func(ctx stepper.Context, data []byte) error {
+			if step == steps[2] {
+				ctx.SetRetryAfter(-1)
+				return fmt.Errorf("step is failed")
+			}
+
+			return nil
+		}).Compensate(func(ctx stepper.Context, data []byte) error {
+			compensated <- step
+			return nil
+		})
+	}
+
+	taskService.RegisterSaga(name, steps...)
+
+	id, err := taskService.StartSaga(ctx, name, []byte("saga"))
+	assert.Nil(t, err)
+
+	listen(t, ctx, taskService)
+
+	assert.Equal(t, steps[1], waitChannelWithTimeout(t, compensated, time.Second*15, "wait for compensation of the second step"))
+	assert.Equal(t, steps[0], waitChannelWithTimeout(t, compensated, time.Second*15, "wait for compensation of the first step"))
+
+	assert.Eventually(t, func() bool {
+		saga, err := taskService.GetSaga(ctx, id)
+		return err == nil && saga.Status == stepper.SagaCompensated && saga.FailedStep == 2
+	}, time.Second*10, time.Millisecond*500)
+}
+
+func durableSleep(t *testing.T, ctx context.Context, taskService stepper.Stepper) {
+	name := xid.New().String()
+
+	firstStep := make(chan struct{}, 2)
+	finished := make(chan struct{}, 1)
+
+	taskService.Publish(ctx, name, nil)
+	taskService.TaskHandler(name, func(ctx stepper.Context, data []byte) error {
+		if err := ctx.Checkpoint("first", func() error {
+			firstStep <- struct{}{}
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		if err := ctx.Sleep(time.Second * 2); err != nil {
+			return err
+		}
+
+		finished <- struct{}{}
+
+		return nil
+	})
+
+	startTime := time.Now()
+
+	listen(t, ctx, taskService)
+
+	waitChannelWithTimeout(t, finished, time.Second*10, "wait for the end of sleep")
+	assert.Equal(t, true, time.Now().After(startTime.Add(time.Second*2)), "the task has woken up without delay")
+	assert.Len(t, firstStep, 1)
+}
+
+func durableCheckpoint(t *testing.T, ctx context.Context, taskService stepper.Stepper) {
+	name := xid.New().String()
+
+	saved := make(chan []byte, 1)
+
+	taskService.Publish(ctx, name, nil)
+	taskService.TaskHandler(name, func(ctx stepper.Context, data []byte) error {
+		if err := ctx.Checkpoint("first", func() error { return nil }); err != nil {
+			return err
+		}
+
+		// the step is saved before the task is finished, so a crash of the node doesn't repeat it
+		tree, err := taskService.GetTaskTree(ctx.Context(), ctx.Task().ID)
+		if err != nil {
+			return err
+		}
+
+		saved <- tree.Task.MiddlewaresState["__durable"]
+
+		return nil
+	})
+
+	listen(t, ctx, taskService)
+
+	assert.Contains(t, string(waitChannelWithTimeout(t, saved, time.Second*10, "wait for the checkpoint")), `"first"`)
+}
+
+func waitForSignal(t *testing.T, ctx context.Context, taskService stepper.Stepper) {
+	name := xid.New().String()
+
+	taskId := make(chan string, 2)
+	received := make(chan []byte, 1)
+
+	taskService.Publish(ctx, name, nil)
+	taskService.TaskHandler(name, func(ctx stepper.Context, data []byte) error {
+		taskId <- ctx.Task().ID
+
+		payload, err := ctx.WaitForSignal("approved", time.Minute)
+		if err != nil {
+			return err
+		}
+
+		received <- payload
+
+		return nil
+	})
+
+	listen(t, ctx, taskService)
+
+	id := waitChannelWithTimeout(t, taskId, time.Second*5, "wait for the task")
+
+	assert.Nil(t, taskService.Signal(ctx, id, "approved", []byte("yes")))
+	assert.Equal(t, "yes", string(waitChannelWithTimeout(t, received, time.Second*5, "wait for the signal")))
+}
+
+func signalDuringHandler(t *testing.T, ctx context.Context, taskService stepper.Stepper) {
+	name := xid.New().String()
+
+	received := make(chan []byte, 1)
+
+	taskService.Publish(ctx, name, nil)
+	taskService.TaskHandler(name, func(ctx stepper.Context, data []byte) error {
+		payload, err := ctx.WaitForSignal("approved", time.Hour)
+		if err != nil {
+			// the signal arrives after the check but before the task is suspended
+			if signalErr := taskService.Signal(ctx.Context(), ctx.Task().ID, "approved", []byte("yes")); signalErr != nil {
+				return signalErr
+			}
+
+			return err
+		}
+
+		received <- payload
+
+		return nil
+	})
+
+	listen(t, ctx, taskService)
+
+	assert.Equal(t, "yes", string(waitChannelWithTimeout(t, received, time.Second*10, "wait for the signal")))
+}
+
+func inheritHeaders(t *testing.T, ctx context.Context, taskService stepper.Stepper) {
+	name := xid.New().String()
+
+	headers := make(chan map[string]string, 1)
+
+	taskService.Publish(ctx, name, nil, stepper.SetHeader("tenant", "42"))
+	taskService.TaskHandler(name, func(ctx stepper.Context, data []byte) error {
+		ctx.CreateSubtask(stepper.CreateTask{
+			Headers: map[string]string{"user": "1"},
+		})
+
+		return nil
+	}).Subtask(func(ctx stepper.Context, data []byte) error {
+		headers <- ctx.Headers()
+		return nil
+	})
+
+	listen(t, ctx, taskService)
+
+	assert.Equal(t, map[string]string{
+		"tenant": "42",
+		"user":   "1",
+	}, waitChannelWithTimeout(t, headers, time.Second*5, "wait for the subtask"))
+}
+
+func inheritJobHeaders(t *testing.T, ctx context.Context, taskService stepper.Stepper) {
+	subtask := xid.New().String()
+
+	jobHeaders := make(chan map[string]string, 1)
+	subtaskHeaders := make(chan map[string]string, 1)
+
+	taskService.RegisterJob(ctx, &stepper.JobConfig{
+		Name:    xid.New().String(),
+		Pattern: "* * * * * *",
+		Headers: map[string]string{"tenant": "42"},
+	}, func(ctx stepper.Context) error {
+		select {
+		case jobHeaders <- ctx.Headers():
+		default:
+		}
+
+		ctx.CreateSubtask(stepper.CreateTask{
+			Name:    subtask,
+			Headers: map[string]string{"user": "1"},
+		})
+
+		return nil
+	})
+
+	taskService.TaskHandler(subtask, func(ctx stepper.Context, data []byte) error {
+		select {
+		case subtaskHeaders <- ctx.Headers():
+		default:
+		}
+
+		return nil
+	})
+
+	listen(t, ctx, taskService)
+
+	assert.Equal(t, map[string]string{"tenant": "42"}, waitChannelWithTimeout(t, jobHeaders, time.Second*5, "wait for the job"))
+	assert.Equal(t, map[string]string{
+		"tenant": "42",
+		"user":   "1",
+	}, waitChannelWithTimeout(t, subtaskHeaders, time.Second*5, "wait for the subtask"))
+}
+
+func secondsJob(t *testing.T, ctx context.Context, taskService stepper.Stepper) {
+	launched := make(chan struct{}, 1)
+
+	taskService.RegisterJob(ctx, &stepper.JobConfig{
+		Name:     xid.New().String(),
+		Pattern:  "*/2 * * * * *",
+		Timezone: "Europe/Berlin",
+	}, func(ctx stepper.Context) error {
+		select {
+		case launched <- struct{}{}:
+		default:
+		}
+
+		return nil
+	})
+
+	listen(t, ctx, taskService)
+
+	waitChannelWithTimeout(t, launched, time.Second*10, "wait for the job")
+}
+
+func jobRuns(t *testing.T, ctx context.Context, taskService stepper.Stepper) {
+	launched := make(chan *stepper.JobRun, 10)
+
+	name := xid.New().String()
+
+	taskService.RegisterJob(ctx, &stepper.JobConfig{
+		Name:     name,
+		Interval: time.Second,
+	}, func(ctx stepper.Context) error {
+		select {
+		case launched <- ctx.JobRun():
+		default:
+		}
+
+		return nil
+	})
+
+	listen(t, ctx, taskService)
+
+	first := waitChannelWithTimeout(t, launched, time.Second*10, "wait for the first run")
+	assert.Equal(t, 1, first.Number)
+	assert.NotEmpty(t, first.ID)
+	assert.Empty(t, first.PreviousStatus)
+	assert.False(t, first.ScheduledAt.IsZero())
+	assert.False(t, first.StartedAt.IsZero(), "the start of the handler must be recorded")
+	assert.False(t, first.StartedAt.Before(first.ScheduledAt))
+
+	second := waitChannelWithTimeout(t, launched, time.Second*10, "wait for the second run")
+	assert.Equal(t, 2, second.Number)
+	assert.NotEqual(t, first.ID, second.ID)
+	assert.Equal(t, stepper.JobRunSucceeded, second.PreviousStatus)
+
+	assert.Eventually(t, func() bool {
+		runs, err := taskService.GetJobRuns(ctx, name, 10)
+
+		return err == nil && len(runs) >= 2 && runs[len(runs)-1].ID == first.ID && runs[len(runs)-2].ID == second.ID
+	}, time.Second*5, time.Millisecond*100, "the history must keep the runs, the latest first")
+}
+
+func invalidJobs(t *testing.T, ctx context.Context, createService ServiceCreator) {
+	configs := []*stepper.JobConfig{
+		{Name: xid.New().String(), Pattern: "* * *", Timezone: "Europe/Berlin"},
+		{Name: xid.New().String(), Pattern: "* * * * *", Timezone: "Mars/Olympus"},
+		{Name: xid.New().String(), Pattern: "* * * * *", Interval: time.Second},
+	}
+
+	for _, cfg := range configs {
+		service := createService()
+
+		assert.NotPanics(t, func() {
+			service.RegisterJob(ctx, cfg, func(ctx stepper.Context) error {
+				return nil
+			})
+		})
+
+		assert.ErrorContains(t, service.Listen(ctx), cfg.Name, "an invalid job must be reported by Listen")
+	}
+}
+
+func keepJobRuns(t *testing.T, ctx context.Context, taskService stepper.Stepper) {
+	launched := make(chan int, 10)
+
+	name := xid.New().String()
+
+	taskService.RegisterJob(ctx, &stepper.JobConfig{
+		Name:     name,
+		Interval: time.Second,
+		KeepRuns: 2,
+	}, func(ctx stepper.Context) error {
+		select {
+		case launched <- ctx.JobRun().Number:
+		default:
+		}
+
+		return nil
+	})
+
+	listen(t, ctx, taskService)
+
+	for range lo.Range(4) {
+		waitChannelWithTimeout(t, launched, time.Second*10, "wait for a run")
+	}
+
+	assert.Eventually(t, func() bool {
+		runs, err := taskService.GetJobRuns(ctx, name, 10)
+
+		return err == nil && len(runs) == 2 && runs[0].Number >= 4
+	}, time.Second*5, time.Millisecond*100, "old runs must be deleted")
+}
+
+func manageJob(t *testing.T, ctx context.Context, taskService stepper.Stepper) {
+	name := xid.New().String()
+
+	launched := make(chan struct{}, 1)
+
+	taskService.RegisterJob(ctx, &stepper.JobConfig{
+		Name:    name,
+		Pattern: "0 0 1 1 *",
+	}, func(ctx stepper.Context) error {
+		launched <- struct{}{}
+		return nil
+	})
+
+	listen(t, ctx, taskService)
+
+	assert.Eventually(t, func() bool {
+		return taskService.TriggerJob(ctx, name) == nil
+	}, time.Second*5, time.Millisecond*100)
+
+	waitChannelWithTimeout(t, launched, time.Second*5, "wait for the triggered job")
+
+	assert.Nil(t, taskService.PauseJob(ctx, name))
+	assert.NotNil(t, taskService.TriggerJob(ctx, name), "a paused job cannot be triggered")
+	assert.Nil(t, taskService.ResumeJob(ctx, name))
+	assert.Nil(t, taskService.UpdateJobPattern(ctx, name, "0 0 1 2 *"))
+	assert.NotNil(t, taskService.UpdateJobPattern(ctx, name, "* *"))
+
+	assert.Nil(t, taskService.DeleteJob(ctx, name))
+	assert.ErrorIs(t, taskService.TriggerJob(ctx, name), stepper.ErrJobNotFound)
+}
+
+func pauseRunningJob(t *testing.T, ctx context.Context, taskService stepper.Stepper) {
+	name := xid.New().String()
+
+	started := make(chan struct{}, 10)
+	release := make(chan struct{})
+
+	taskService.RegisterJob(ctx, &stepper.JobConfig{
+		Name:    name,
+		Pattern: "* * * * * *",
+	}, func(ctx stepper.Context) error {
+		started <- struct{}{}
+		<-release
+		return nil
+	})
+
+	listen(t, ctx, taskService)
+
+	waitChannelWithTimeout(t, started, time.Second*10, "wait for the job")
+
+	assert.Nil(t, taskService.PauseJob(ctx, name))
+	close(release)
+
+	// the run is finished by the claiming node, but the pause must be kept
+	select {
+	case <-started:
+		t.Fatal("a paused job is launched")
+	case <-time.After(time.Second * 4):
+	}
+
+	assert.Nil(t, taskService.ResumeJob(ctx, name))
+	waitChannelWithTimeout(t, started, time.Second*10, "wait for the resumed job")
+}
+
+func overlapJob(t *testing.T, ctx context.Context, taskService stepper.Stepper) {
+	name := xid.New().String()
+
+	var running int32
+	started := make(chan string, 2)
+	release := make(chan struct{})
+
+	taskService.RegisterJob(ctx, &stepper.JobConfig{
+		Name:    name,
+		Pattern: "* * * * * *",
+		Overlap: stepper.OverlapAllow,
+	}, func(ctx stepper.Context) error {
+		atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+
+		select {
+		case started <- ctx.JobRun().ID:
+		default:
+		}
+
+		<-release
+
+		return nil
+	})
+
+	listen(t, ctx, taskService)
+
+	first := waitChannelWithTimeout(t, started, time.Second*10, "wait for the first run")
+	second := waitChannelWithTimeout(t, started, time.Second*10, "wait for the concurrent run")
+
+	assert.NotEqual(t, first, second, "concurrent runs must have own run ids")
+
+	// the runs must not hold workers of the pool after the test
+	assert.Nil(t, taskService.PauseJob(ctx, name))
+	close(release)
+
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&running) == 0
+	}, time.Second*5, time.Millisecond*100, "the runs must be released")
+}
+
+func intervalAndOneOffJobs(t *testing.T, ctx context.Context, taskService stepper.Stepper) {
+	intervalLaunched := make(chan struct{}, 10)
+	oneOffLaunched := make(chan struct{}, 10)
+
+	taskService.RegisterJob(ctx, &stepper.JobConfig{
+		Name:     xid.New().String(),
+		Interval: time.Second,
+		Jitter:   0.5,
+	}, func(ctx stepper.Context) error {
+		intervalLaunched <- struct{}{}
+		return nil
+	})
+
+	taskService.RegisterJob(ctx, &stepper.JobConfig{
+		Name:  xid.New().String(),
+		RunAt: time.Now().Add(time.Second),
+	}, func(ctx stepper.Context) error {
+		oneOffLaunched <- struct{}{}
+		return nil
+	})
+
+	listen(t, ctx, taskService)
+
+	waitChannelWithTimeout(t, intervalLaunched, time.Second*10, "wait for the first interval launch")
+	waitChannelWithTimeout(t, intervalLaunched, time.Second*10, "wait for the second interval launch")
+	waitChannelWithTimeout(t, oneOffLaunched, time.Second*10, "wait for the one-off launch")
+
+	time.Sleep(time.Second * 3)
+
+	assert.Len(t, oneOffLaunched, 0, "the one-off job must be launched once")
+}
+
+func nodeTags(t *testing.T, ctx context.Context, createService ServiceCreator) {
+	handledBy := make(chan string, 10)
+
+	name := xid.New().String()
+	tag := xid.New().String()
+
+	untagged := createService()
+	tagged := createService(stepper.WithNodeTags(tag, "other"))
+
+	untagged.TaskHandler(name, func(ctx stepper.Context, data []byte) error {
+		handledBy <- "untagged"
+		return nil
+	})
+
+	tagged.TaskHandler(name, func(ctx stepper.Context, data []byte) error {
+		handledBy <- "tagged"
+		return nil
+	})
+
+	listen(t, ctx, untagged)
+
+	assert.Nil(t, untagged.Publish(ctx, name, nil, stepper.SetTags(tag)))
+
+	time.Sleep(time.Second * 3)
+	assert.Len(t, handledBy, 0, "a node without the tag must not claim the task")
+
+	listen(t, ctx, tagged)
+
+	assert.Equal(t, "tagged", waitChannelWithTimeout(t, handledBy, time.Second*10, "wait for the tagged node"))
+}
+
+func namedQueues(t *testing.T, ctx context.Context, createService ServiceCreator) {
+	handledBy := make(chan string, 10)
+
+	name := xid.New().String()
+	queue := xid.New().String()
+
+	defaultQueue := createService()
+	namedQueue := createService(stepper.WithQueues(queue))
+
+	defaultQueue.TaskHandler(name, func(ctx stepper.Context, data []byte) error {
+		handledBy <- "default"
+		return nil
+	})
+
+	namedQueue.TaskHandler(name, func(ctx stepper.Context, data []byte) error {
+		handledBy <- "named"
+		return nil
+	})
+
+	listen(t, ctx, defaultQueue)
+
+	assert.Nil(t, defaultQueue.Publish(ctx, name, nil, stepper.SetQueue(queue)))
+
+	time.Sleep(time.Second * 3)
+	assert.Len(t, handledBy, 0, "a node must not claim tasks of other queues")
+
+	listen(t, ctx, namedQueue)
+
+	assert.Equal(t, "named", waitChannelWithTimeout(t, handledBy, time.Second*10, "wait for the queue worker"))
+}
+
+func deadLetterUnhandled(t *testing.T, ctx context.Context, engine stepper.Engine, createService ServiceCreator) {
+	name, tagged := xid.New().String(), xid.New().String()
+
+	// the name of the tagged task is handled, but no node serves its tags
+	worker := createService()
+	worker.TaskHandler(tagged, func(ctx stepper.Context, data []byte) error {
+		return nil
+	})
+
+	listen(t, ctx, worker)
+
+	scanner := createService(stepper.WithUnhandledTasks(stepper.UnhandledTasks{
+		Policy:   stepper.UnhandledDeadLetter,
+		After:    time.Millisecond,
+		Interval: time.Second,
+	}))
+
+	dead := deadTasks(scanner, name, tagged)
+
+	listen(t, ctx, scanner)
+
+	assert.Nil(t, scanner.Publish(ctx, name, nil))
+	assert.Nil(t, scanner.Publish(ctx, tagged, nil, stepper.SetTags("gpu")))
+
+	assert.Eventually(t, func() bool {
+		value, ok := gaugeValue(t, "stepper_unhandled_tasks", map[string]string{"task": name})
+		return ok && value == 1
+	}, time.Second*5, time.Millisecond*100, "the task must be reported as unhandled")
+
+	for range lo.Range(2) {
+		task := waitChannelWithTimeout(t, dead, time.Second*10, "wait for a dead-lettered task")
+
+		stored, err := engine.GetTask(ctx, task.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, "dead_letter", stored.Status)
+	}
+
+	handled := make(chan struct{}, 1)
+
+	late := createService()
+	late.TaskHandler(name, func(ctx stepper.Context, data []byte) error {
+		handled <- struct{}{}
+		return nil
+	})
+
+	listen(t, ctx, late)
+
+	time.Sleep(time.Second * 3)
+	assert.Len(t, handled, 0, "a dead-lettered task must not be launched")
+}
+
+func failUnhandled(t *testing.T, ctx context.Context, engine stepper.Engine, createService ServiceCreator) {
+	name := xid.New().String()
+
+	scanner := createService(stepper.WithUnhandledTasks(stepper.UnhandledTasks{
+		Policy:   stepper.UnhandledFail,
+		After:    time.Millisecond,
+		Interval: time.Second,
+	}))
+
+	dead := deadTasks(scanner, name)
+
+	listen(t, ctx, scanner)
+
+	assert.Nil(t, scanner.Publish(ctx, name, nil))
+
+	task := waitChannelWithTimeout(t, dead, time.Second*10, "wait for a failed task")
+	assert.ErrorIs(t, task.err, stepper.ErrNoHandler)
+
+	stored, err := engine.GetTask(ctx, task.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "failed", stored.Status)
+	assert.True(t, stored.LaunchAt.IsZero(), "a failed task must not be retried")
+}
+
+type deadTask struct {
+	*stepper.Task
+	err error
+}
+
+// deadTasks returns tasks with the names which are dead
+func deadTasks(service stepper.Stepper, names ...string) chan deadTask {
+	dead := make(chan deadTask, 10)
+
+	service.OnEvent(func(ctx context.Context, event stepper.Event) {
+		if event.Type == stepper.EventDead && lo.Contains(names, event.Task.Name) {
+			dead <- deadTask{Task: event.Task, err: event.Err}
+		}
+	})
+
+	return dead
+}
+
+func misfireJobs(t *testing.T, ctx context.Context, engine stepper.Engine, createService ServiceCreator) {
+	policies := []stepper.MisfirePolicy{stepper.MisfireSkip, stepper.MisfireRunOnce, stepper.MisfireRunAll}
+
+	configs := lo.Map(policies, func(policy stepper.MisfirePolicy, i int) *stepper.JobConfig {
+		return &stepper.JobConfig{Name: xid.New().String(), Pattern: "*/2 * * * * *", MisfirePolicy: policy}
+	})
+
+	// the jobs are registered by a node which is gone, so their launches are missed
+	for _, cfg := range configs {
+		assert.Nil(t, engine.RegisterJob(ctx, cfg))
+	}
+
+	registeredAt := time.Now()
+
+	time.Sleep(time.Second * 5)
+
+	startedAt := time.Now().Truncate(time.Second)
+
+	taskService := createService()
+
+	runs := make([]chan time.Time, len(configs))
+
+	for i, cfg := range configs {
+		launched := make(chan time.Time, 10)
+		runs[i] = launched
+
+		taskService.RegisterJob(ctx, cfg, func(ctx stepper.Context) error {
+			select {
+			case launched <- ctx.JobRun().ScheduledAt:
+			default:
+			}
+
+			return nil
+		})
+	}
+
+	listen(t, ctx, taskService)
+
+	skipped := waitChannelWithTimeout(t, runs[0], time.Second*10, "wait for the skipping job")
+	assert.False(t, skipped.Before(startedAt), "missed launches must be skipped")
+
+	once := waitChannelWithTimeout(t, runs[1], time.Second*10, "wait for the missed launches")
+	assert.True(t, once.After(registeredAt.Add(time.Second*3)), "the run must be for the latest missed launch")
+	assert.False(t, once.After(time.Now()))
+	next := waitChannelWithTimeout(t, runs[1], time.Second*10, "wait for the next launch")
+	assert.True(t, next.After(once), "missed launches must be run once")
+
+	first := waitChannelWithTimeout(t, runs[2], time.Second*10, "wait for the first missed launch")
+	second := waitChannelWithTimeout(t, runs[2], time.Second*10, "wait for the second missed launch")
+	assert.True(t, first.Before(startedAt), "the missed launch must be run")
+	assert.Equal(t, time.Second*2, second.Sub(first), "every missed launch must be run")
+}
+
+func jitterFirstLaunch(t *testing.T, ctx context.Context, engine stepper.Engine, createService ServiceCreator) {
+	launches := map[time.Time]bool{}
+
+	for range lo.Range(10) {
+		cfg := &stepper.JobConfig{Name: xid.New().String(), Interval: time.Hour, Jitter: 0.5}
+
+		scheduled, err := cfg.NextLaunch()
+		assert.Nil(t, err)
+		assert.Nil(t, engine.RegisterJob(ctx, cfg))
+
+		job, err := engine.GetJob(ctx, cfg.Name)
+		assert.Nil(t, err)
+		assert.NotNil(t, job)
+
+		assert.WithinDuration(t, scheduled, job.ScheduledLaunch(), time.Second, "the launch must keep the scheduled time")
+		assert.True(t, job.NextLaunchAt.After(time.Now()), "the launch must not be moved to the past")
+
+		launches[job.NextLaunchAt] = true
+	}
+
+	assert.Greater(t, len(launches), 1, "the first launches of jobs must be spread out")
+}
+
+func reconcileJobs(t *testing.T, ctx context.Context, engine stepper.Engine, createService ServiceCreator) {
+	orphaned, running := xid.New().String(), xid.New().String()
+
+	// the jobs are registered by a node which is gone
+	assert.Nil(t, engine.RegisterJob(ctx, &stepper.JobConfig{Name: orphaned, Pattern: "0 0 1 1 *"}))
+	assert.Nil(t, engine.RegisterJob(ctx, &stepper.JobConfig{Name: running, Pattern: "* * * * * *"}))
+
+	assert.Eventually(t, func() bool {
+		job, err := engine.FindNextJob(ctx, []string{"created"}, stepper.ClaimFilter{Names: []string{running}})
+		return err == nil && job != nil
+	}, time.Second*5, time.Millisecond*100, "the job must be in flight")
+
+	reports := make(chan *stepper.ReconciliationReport, 10)
+
+	reconciler := createService(stepper.WithJobReconciliation(stepper.JobReconciliation{
+		Interval:    time.Second,
+		DeleteAfter: time.Second * 2,
+		OnReport: func(report *stepper.ReconciliationReport) {
+			select {
+			case reports <- report:
+			default:
+			}
+		},
+	}))
+
+	listen(t, ctx, reconciler)
+
+	var isOrphaned, isDeleted bool
+
+	for i := 0; i < 10 && !isDeleted; i++ {
+		report := waitChannelWithTimeout(t, reports, time.Second*5, "wait for a report")
+
+		assert.NotContains(t, report.Orphaned, running, "a job in flight must not be orphaned")
+		assert.Positive(t, report.Nodes)
+
+		isOrphaned = isOrphaned || lo.Contains(report.Orphaned, orphaned)
+		isDeleted = lo.Contains(report.Deleted, orphaned)
+	}
+
+	assert.True(t, isOrphaned, "the job must be reported as orphaned")
+	assert.True(t, isDeleted, "the job must be deleted after the grace period")
+
+	job, err := engine.GetJob(ctx, orphaned)
+	assert.Nil(t, err)
+	assert.Nil(t, job)
+
+	job, err = engine.GetJob(ctx, running)
+	assert.Nil(t, err)
+	assert.Equal(t, "in_progress", job.Status)
+}
+
+func dependOnCustomId(t *testing.T, ctx context.Context, taskService stepper.Stepper) {
+	name := xid.New().String()
+
+	var running int32
+	order := make(chan string, 4)
+
+	taskService.TaskHandler(name, func(ctx stepper.Context, data []byte) error {
+		// a task with another custom id does not depend on the others
+		if string(data) == "other" {
+			order <- string(data)
+			return nil
+		}
+
+		assert.Equal(t, int32(1), atomic.AddInt32(&running, 1), "tasks with the same custom id must not run concurrently")
+		defer atomic.AddInt32(&running, -1)
+
+		time.Sleep(time.Millisecond * 300)
+		order <- string(data)
+
+		return nil
+	}).DependOnCustomId()
+
+	for i := range lo.Range(3) {
+		assert.Nil(t, taskService.Publish(ctx, name, []byte(fmt.Sprintf("%v", i)), stepper.SetCustomId("order-1")))
+	}
+
+	assert.Nil(t, taskService.Publish(ctx, name, []byte("other"), stepper.SetCustomId("order-2")))
+
+	listen(t, ctx, taskService)
+
+	result := make([]string, 0, 4)
+
+	for range lo.Range(4) {
+		select {
+		case data := <-order:
+			result = append(result, data)
+		case <-time.After(time.Second * 10):
+			t.Fatal("tasks with custom ids were not launched")
+		}
+	}
+
+	assert.Contains(t, result, "other")
+	assert.Equal(t, []string{"0", "1", "2"}, lo.Without(result, "other"))
+}
+
+func lifecycleEvents(t *testing.T, ctx context.Context, taskService stepper.Stepper) {
+	name := xid.New().String()
+
+	var mu sync.Mutex
+	events := map[string][]stepper.EventType{}
+
+	taskService.OnEvent(func(ctx context.Context, event stepper.Event) {
+		if event.Task == nil || !strings.HasSuffix(event.Task.Name, name) {
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		events[event.Task.Name] = append(events[event.Task.Name], event.Type)
+	})
+
+	finished := make(chan struct{}, 1)
+
+	taskService.TaskHandler(name, func(ctx stepper.Context, data []byte) error {
+		ctx.CreateSubtask(stepper.CreateTask{})
+		return nil
+	}).Subtask(func(ctx stepper.Context, data []byte) error {
+		return nil
+	}).OnFinish(func(ctx stepper.Context, data []byte) error {
+		finished <- struct{}{}
+		return nil
+	})
+
+	assert.Nil(t, taskService.Publish(ctx, name, nil))
+
+	listen(t, ctx, taskService)
+
+	select {
+	case <-finished:
+	case <-time.After(time.Second * 10):
+		t.Fatal("the task was not finished")
+	}
+
+	// the parent is released after OnFinish returns
+	time.Sleep(time.Millisecond * 500)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	// the task succeeds when its subtasks are created
+	assert.Equal(t, []stepper.EventType{
+		stepper.EventPublished,
+		stepper.EventClaimed,
+		stepper.EventSubtasksCreated,
+		stepper.EventSucceeded,
+		stepper.EventParentFinished,
+	}, events[name])
+
+	assert.Equal(t, []stepper.EventType{
+		stepper.EventClaimed,
+		stepper.EventSucceeded,
+	}, events["__subtask:"+name])
+}
+
+func panickingListener(t *testing.T, ctx context.Context, taskService stepper.Stepper) {
+	name := xid.New().String()
+
+	succeeded := make(chan struct{}, 1)
+
+	taskService.OnEvent(func(ctx context.Context, event stepper.Event) {
+		if event.Task != nil && event.Task.Name == name {
+			panic("broken listener")
+		}
+	})
+
+	taskService.OnEvent(func(ctx context.Context, event stepper.Event) {
+		if event.Task != nil && event.Task.Name == name && event.Type == stepper.EventSucceeded {
+			succeeded <- struct{}{}
+		}
+	})
+
+	taskService.TaskHandler(name, func(ctx stepper.Context, data []byte) error {
+		return nil
+	})
+
+	assert.Nil(t, taskService.Publish(ctx, name, nil))
+
+	listen(t, ctx, taskService)
+
+	waitChannelWithTimeout(t, succeeded, time.Second*10, "the task must be handled despite the panicking listener")
+}
+
+func classifyErrors(t *testing.T, ctx context.Context, taskService stepper.Stepper) {
+	permanent, delayed := xid.New().String(), xid.New().String()
+
+	events := make(chan stepper.Event, 10)
+
+	taskService.OnEvent(func(ctx context.Context, event stepper.Event) {
+		if event.Type != stepper.EventFailed && event.Type != stepper.EventDead {
+			return
+		}
+
+		if event.Task.Name == permanent || event.Task.Name == delayed {
+			events <- event
+		}
+	})
+
+	taskService.TaskHandler(permanent, func(ctx stepper.Context, data []byte) error {
+		return stepper.Permanent(fmt.Errorf("invalid data"))
+	})
+
+	taskService.TaskHandler(delayed, func(ctx stepper.Context, data []byte) error {
+		return stepper.RetryAfter(fmt.Errorf("too many requests"), time.Hour)
+	}).UseMiddleware(middlewares.Retry(middlewares.RetryOptions{MaxRetries: 3}))
+
+	assert.Nil(t, taskService.Publish(ctx, permanent, nil))
+	assert.Nil(t, taskService.Publish(ctx, delayed, nil))
+
+	listen(t, ctx, taskService)
+
+	for i := 0; i < 2; i++ {
+		event := waitChannelWithTimeout(t, events, time.Second*10, "wait for a failed task")
+
+		switch event.Task.Name {
+		case permanent:
+			assert.Equal(t, stepper.EventDead, event.Type)
+			assert.True(t, stepper.IsPermanent(event.Err))
+		case delayed:
+			assert.Equal(t, stepper.EventFailed, event.Type)
+			assert.WithinDuration(t, time.Now().Add(time.Hour), event.RetryAt, time.Minute)
+		}
+	}
+}
+
+func retryBackoff(t *testing.T, ctx context.Context, taskService stepper.Stepper) {
+	name := xid.New().String()
+	errFatal := errors.New("fatal")
+
+	events := make(chan stepper.Event, 10)
+
+	taskService.OnEvent(func(ctx context.Context, event stepper.Event) {
+		if event.Task != nil && event.Task.Name == name && (event.Type == stepper.EventFailed || event.Type == stepper.EventDead) {
+			events <- event
+		}
+	})
+
+	backoffAttempts := make(chan int, 5)
+
+	taskService.TaskHandler(name, func(ctx stepper.Context, data []byte) error {
+		if ctx.Attempt() > 1 {
+			return errFatal
+		}
+
+		return fmt.Errorf("temporary error")
+	}).UseMiddleware(middlewares.Retry(middlewares.RetryOptions{
+		MaxRetries: 5,
+		Backoff: middlewares.BackoffFunc(func(attempt int, err error) time.Duration {
+			backoffAttempts <- attempt
+			return time.Second
+		}),
+		RetryIf: func(err error) bool {
+			return !errors.Is(err, errFatal)
+		},
+	}))
+
+	assert.Nil(t, taskService.Publish(ctx, name, nil))
+
+	listen(t, ctx, taskService)
+
+	event := waitChannelWithTimeout(t, events, time.Second*10, "wait for a failed task")
+	assert.Equal(t, stepper.EventFailed, event.Type)
+	assert.WithinDuration(t, time.Now().Add(time.Second), event.RetryAt, time.Millisecond*500)
+
+	event = waitChannelWithTimeout(t, events, time.Second*10, "wait for a dead task")
+	assert.Equal(t, stepper.EventDead, event.Type)
+	assert.ErrorIs(t, event.Err, errFatal)
+	assert.Equal(t, 2, event.Task.Attempt)
+	assert.Equal(t, 1, <-backoffAttempts)
+	assert.Len(t, backoffAttempts, 0)
+}
+
+func countAttempts(t *testing.T, ctx context.Context, taskService stepper.Stepper) {
+	name := xid.New().String()
+
+	attempts := make(chan int, 5)
+	finished := make(chan struct{}, 1)
+
+	var failed int32
+
+	taskService.TaskHandler(name, func(ctx stepper.Context, data []byte) error {
+		attempts <- ctx.Attempt()
+
+		if err := ctx.Sleep(time.Second); err != nil {
+			return err
+		}
+
+		if atomic.CompareAndSwapInt32(&failed, 0, 1) {
+			ctx.SetRetryAfter(time.Millisecond)
+			return fmt.Errorf("temporary error")
+		}
+
+		finished <- struct{}{}
+
+		return nil
+	})
+
+	assert.Nil(t, taskService.Publish(ctx, name, nil))
+
+	listen(t, ctx, taskService)
+
+	waitChannelWithTimeout(t, finished, time.Second*10, "wait for the task")
+
+	// the launch which suspends the task is not counted
+	assert.Equal(t, 1, <-attempts)
+	assert.Equal(t, 1, <-attempts)
+	assert.Equal(t, 2, <-attempts)
+}
+
+func collectMetrics(t *testing.T, ctx context.Context, createService ServiceCreator) {
+	name := xid.New().String()
+
+	service := createService(stepper.WithMetricsInterval(time.Millisecond * 100))
+
+	// nobody handles the tasks, so they stay due
+	for range lo.Range(3) {
+		assert.Nil(t, service.Publish(ctx, name, nil))
+	}
+
+	listen(t, ctx, service)
+
+	time.Sleep(time.Second)
+
+	count, ok := gaugeValue(t, "stepper_tasks", map[string]string{"task": name, "status": "created"})
+	assert.True(t, ok)
+	assert.Equal(t, float64(3), count)
+
+	lag, ok := gaugeValue(t, "stepper_queue_lag_seconds", map[string]string{"task": name})
+	assert.True(t, ok)
+	assert.Greater(t, lag, float64(0))
+}
+
+func traceTasks(t *testing.T, ctx context.Context, createService ServiceCreator) {
+	name := xid.New().String()
+
+	recorder := tracetest.NewSpanRecorder()
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	service := createService(stepper.WithPropagator(middlewares.TracePropagator()))
+	service.UseMiddleware(middlewares.OpenTelemetry(tracerProvider))
+
+	handled := make(chan struct{}, 1)
+
+	service.TaskHandler(name, func(ctx stepper.Context, data []byte) error {
+		ctx.CreateSubtask(stepper.CreateTask{Data: data})
+		return nil
+	}).Subtask(func(ctx stepper.Context, data []byte) error {
+		handled <- struct{}{}
+		return nil
+	})
+
+	publishCtx, publishSpan := tracerProvider.Tracer("tests").Start(ctx, "publish")
+	assert.Nil(t, service.Publish(publishCtx, name, nil))
+	publishSpan.End()
+
+	listen(t, ctx, service)
+
+	select {
+	case <-handled:
+	case <-time.After(time.Second * 5):
+		t.Fatal("the subtask was not handled")
+	}
+
+	// the span of the subtask is ended after its handler returns
+	time.Sleep(time.Millisecond * 100)
+
+	spans := lo.SliceToMap(recorder.Ended(), func(span sdktrace.ReadOnlySpan) (string, sdktrace.ReadOnlySpan) {
+		return span.Name(), span
+	})
+
+	task, subtask := spans[name], spans["__subtask:"+name]
+	if !assert.NotNil(t, task) || !assert.NotNil(t, subtask) {
+		return
+	}
+
+	assert.Equal(t, publishSpan.SpanContext().TraceID(), task.SpanContext().TraceID())
+	assert.Equal(t, publishSpan.SpanContext().SpanID(), task.Parent().SpanID())
+	assert.Equal(t, task.SpanContext().TraceID(), subtask.SpanContext().TraceID())
+	assert.Equal(t, task.SpanContext().SpanID(), subtask.Parent().SpanID())
+}
+
+func structuredLogs(t *testing.T, ctx context.Context, createService ServiceCreator) {
+	name := xid.New().String()
+
+	logger := &recordLogger{}
+	handled := make(chan struct{}, 2)
+
+	service := createService(stepper.WithLogger(logger))
+	service.TaskHandler(name, func(ctx stepper.Context, data []byte) error {
+		defer func() { handled <- struct{}{} }()
+
+		if string(data) == "fail" {
+			ctx.SetRetryAfter(time.Hour)
+			return fmt.Errorf("failed")
+		}
+
+		return nil
+	}, middlewares.Log(logger, middlewares.LogOptions{
+		MaxDataLength: 3,
+		Redact: func(task *stepper.Task, data []byte) []byte {
+			return []byte("секрет")
+		},
+	}))
+
+	assert.Nil(t, service.Publish(ctx, name, []byte("done")))
+	assert.Nil(t, service.Publish(ctx, name, []byte("fail")))
+
+	listen(t, ctx, service)
+
+	for range lo.Range(2) {
+		select {
+		case <-handled:
+		case <-time.After(time.Second * 5):
+			t.Fatal("tasks were not handled")
+		}
+	}
+
+	// logs are written after the handler returns
+	time.Sleep(time.Millisecond * 500)
+
+	completed, ok := logger.find("task is completed", "task", name)
+	if assert.True(t, ok) {
+		assert.Equal(t, 1, completed.attrs["attempt"])
+		assert.NotEmpty(t, completed.attrs["task_id"])
+		assert.Contains(t, completed.attrs, "duration")
+	}
+
+	failed, ok := logger.find("task is failed", "task", name)
+	if assert.True(t, ok) {
+		assert.Equal(t, "warn", failed.level)
+		assert.Equal(t, time.Hour, failed.attrs["retry_after"])
+	}
+
+	taken, ok := logger.find("take task", "task", name)
+	if assert.True(t, ok) {
+		// a character of two bytes is not cut
+		assert.Equal(t, "с...", taken.attrs["data"])
+	}
+}
+
+// gaugeValue returns the value of the gauge with the labels from the default registry
+func gaugeValue(t *testing.T, metric string, labels map[string]string) (float64, bool) {
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, family := range families {
+		if family.GetName() != metric {
+			continue
+		}
+
+		for _, m := range family.GetMetric() {
+			values := map[string]string{}
+			for _, label := range m.GetLabel() {
+				values[label.GetName()] = label.GetValue()
+			}
+
+			if lo.Every(lo.Entries(values), lo.Entries(labels)) {
+				return m.GetGauge().GetValue(), true
+			}
+		}
+	}
+
+	return 0, false
+}
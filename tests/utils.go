@@ -6,6 +6,7 @@ import (
 	"reflect"
 	"runtime"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -125,3 +126,46 @@ func (d *doorman) EqualValues(task string, values []string) {
 		assert.Equal(d.t, v, string(d.OnTask(task, false, "").data))
 	}
 }
+
+type logRecord struct {
+	level string
+	msg   string
+	attrs map[string]any
+}
+
+// recordLogger records logs, it is safe for concurrent use
+type recordLogger struct {
+	mu      sync.Mutex
+	records []logRecord
+}
+
+func (l *recordLogger) Debug(msg string, args ...any) { l.record("debug", msg, args) }
+func (l *recordLogger) Info(msg string, args ...any)  { l.record("info", msg, args) }
+func (l *recordLogger) Warn(msg string, args ...any)  { l.record("warn", msg, args) }
+func (l *recordLogger) Error(msg string, args ...any) { l.record("error", msg, args) }
+
+func (l *recordLogger) record(level string, msg string, args []any) {
+	attrs := map[string]any{}
+	for i := 0; i+1 < len(args); i += 2 {
+		attrs[fmt.Sprint(args[i])] = args[i+1]
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.records = append(l.records, logRecord{level: level, msg: msg, attrs: attrs})
+}
+
+// find returns the first record with the message and the attribute
+func (l *recordLogger) find(msg string, key string, value any) (logRecord, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, record := range l.records {
+		if record.msg == msg && record.attrs[key] == value {
+			return record, true
+		}
+	}
+
+	return logRecord{}, false
+}
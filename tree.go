@@ -0,0 +1,82 @@
+package stepper
+
+import (
+	"context"
+	"fmt"
+)
+
+type TaskTree struct {
+	Task     *Task
+	Children []*TaskTree
+	Progress TaskProgress
+}
+
+// TaskProgress counts all descendants of a task, not only the direct children.
+type TaskProgress struct {
+	Total    int
+	Released int
+	Dead     int
+	Pending  int
+}
+
+func (p TaskProgress) Done() int {
+	return p.Released + p.Dead
+}
+
+func (p TaskProgress) Percent() float64 {
+	if p.Total == 0 {
+		return 100
+	}
+
+	return float64(p.Done()) / float64(p.Total) * 100
+}
+
+func (p *TaskProgress) add(task *Task, children TaskProgress) {
+	p.Total += children.Total + 1
+	p.Released += children.Released
+	p.Dead += children.Dead
+	p.Pending += children.Pending
+
+	switch {
+	case task.IsReleased():
+		p.Released++
+	case task.IsDead():
+		p.Dead++
+	default:
+		p.Pending++
+	}
+}
+
+func (s *Service) GetTaskTree(ctx context.Context, rootID string) (*TaskTree, error) {
+	root, err := s.mongo.GetTask(ctx, rootID)
+	if err != nil {
+		return nil, err
+	}
+
+	if root == nil {
+		return nil, ErrTaskNotFound
+	}
+
+	return s.buildTaskTree(ctx, root)
+}
+
+func (s *Service) buildTaskTree(ctx context.Context, task *Task) (*TaskTree, error) {
+	children, err := s.mongo.GetTaskChildren(ctx, task.ID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get children of task=%s: %w", task.ID, err)
+	}
+
+	tree := &TaskTree{Task: task}
+
+	for _, child := range children {
+		subtree, err := s.buildTaskTree(ctx, child)
+		if err != nil {
+			return nil, err
+		}
+
+		tree.Children = append(tree.Children, subtree)
+		tree.Progress.add(child, subtree.Progress)
+	}
+
+	return tree, nil
+}
@@ -0,0 +1,185 @@
+package stepper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/samber/lo"
+)
+
+var ErrNoHandler = errors.New("no handler for the task")
+
+type UnhandledTaskPolicy string
+
+// DueTasks is a count of tasks which are ready to be launched and have the same name, queue and tags.
+type DueTasks struct {
+	Name  string
+	Queue string
+	Tags  []string
+	Count int64
+}
+
+func (d DueTasks) key() string {
+	tags := append([]string{}, d.Tags...)
+	sort.Strings(tags)
+
+	return strings.Join(append([]string{d.Name, d.Queue}, tags...), "\x00")
+}
+
+// claimedBy reports whether the node claims the tasks, nodes without queues listen the default queue
+func (d DueTasks) claimedBy(node *Node) bool {
+	queues := lo.Ternary(node.Queues == nil, []string{DefaultQueue}, node.Queues)
+
+	return lo.Contains(node.Tasks, d.Name) && lo.Contains(queues, d.Queue) && lo.Every(node.Tags, d.Tags)
+}
+
+const (
+	// UnhandledLeave leaves tasks in the queue until some node with a handler takes them
+	UnhandledLeave UnhandledTaskPolicy = "leave"
+	// UnhandledFail fails tasks without retries
+	UnhandledFail UnhandledTaskPolicy = "fail"
+	// UnhandledDeadLetter moves tasks to the dead_letter status
+	UnhandledDeadLetter UnhandledTaskPolicy = "dead_letter"
+)
+
+// unhandledRetryDelay is a delay before a left task can be claimed again
+const unhandledRetryDelay = time.Second * 10
+
+type UnhandledTasks struct {
+	Policy UnhandledTaskPolicy
+	// After is a grace period during which a task name has no handler on all alive nodes
+	// before the policy is applied, 5 minutes by default
+	After time.Duration
+	// Interval between checks, a minute by default
+	Interval time.Duration
+}
+
+// WithUnhandledTasks configures what to do with tasks which have no handler.
+// By default tasks are left in the queue and only reported by the stepper_unhandled_tasks metric.
+func WithUnhandledTasks(cfg UnhandledTasks) ServiceOption {
+	return func(s *Service) {
+		s.unhandled = cfg
+	}
+}
+
+func (s *Service) handleUnhandledTask(ctx context.Context, task *Task) error {
+	err := fmt.Errorf("%w: %s", ErrNoHandler, task.Name)
+
+	switch s.unhandled.Policy {
+	case UnhandledFail:
+		if err := s.mongo.FailTask(ctx, task, err, -1); err != nil {
+			return err
+		}
+	case UnhandledDeadLetter:
+		if err := s.mongo.DeadLetterTask(ctx, task, err); err != nil {
+			return err
+		}
+	default:
+		return s.mongo.SuspendTask(ctx, task, time.Now().Add(unhandledRetryDelay))
+	}
+
+	s.emit(ctx, Event{Type: EventDead, Task: task, Err: err})
+
+	return nil
+}
+
+func (s *Service) listenUnhandledTasks(ctx context.Context) error {
+	interval := lo.Ternary(s.unhandled.Interval == 0, time.Minute, s.unhandled.Interval)
+
+	// the moment since which a task name has no handler
+	since := map[string]time.Time{}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+			if err := s.checkUnhandledTasks(ctx, since); err != nil {
+				s.logger.Error("cannot check unhandled tasks", "error", err)
+			}
+		}
+	}
+}
+
+func (s *Service) checkUnhandledTasks(ctx context.Context, since map[string]time.Time) error {
+	nodes, ok, err := s.aliveNodes(ctx)
+	if err != nil || !ok {
+		return err
+	}
+
+	groups, err := s.mongo.CountDueTasks(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot count due tasks: %w", err)
+	}
+
+	s.metrics.unhandled.Reset()
+
+	counts := map[string]int64{}
+	due := map[string]bool{}
+
+	var expired []DueTasks
+
+	for _, group := range groups {
+		key := group.key()
+		due[key] = true
+
+		if lo.SomeBy(nodes, group.claimedBy) {
+			delete(since, key)
+			continue
+		}
+
+		counts[group.Name] += group.Count
+
+		if _, ok := since[key]; !ok {
+			since[key] = time.Now()
+		}
+
+		if time.Since(since[key]) >= lo.Ternary(s.unhandled.After == 0, time.Minute*5, s.unhandled.After) {
+			expired = append(expired, group)
+		}
+	}
+
+	for name, count := range counts {
+		s.metrics.unhandled.WithLabelValues(name).Set(float64(count))
+	}
+
+	for key := range since {
+		if !due[key] {
+			delete(since, key)
+		}
+	}
+
+	if len(expired) == 0 || s.unhandled.Policy == "" || s.unhandled.Policy == UnhandledLeave {
+		return nil
+	}
+
+	for _, group := range expired {
+		filter := ClaimFilter{
+			Names:     []string{group.Name},
+			Queues:    []string{group.Queue},
+			Tags:      append([]string{}, group.Tags...),
+			ExactTags: true,
+		}
+
+		for {
+			task, err := s.mongo.FindNextTask(ctx, []string{"created", "in_progress", "failed", "suspended"}, filter)
+			if err != nil {
+				return err
+			}
+
+			if task == nil {
+				break
+			}
+
+			if err := s.handleUnhandledTask(ctx, task); err != nil {
+				return fmt.Errorf("cannot handle unhandled task=%s: %w", task.ID, err)
+			}
+		}
+	}
+
+	return nil
+}